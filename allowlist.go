@@ -0,0 +1,33 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// clientAllowed reports whether the client that made req
+// is allowed to use the event path, as configured by [WithAllowedClients].
+func (h *Handler) clientAllowed(req *http.Request) bool {
+	if h.allowedClients == nil {
+		return true
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range h.allowedClients {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// documentCharset returns the character encoding of the document doc
+// served with the given Content-Type, as specified by its byte order mark,
+// the charset parameter of contentType, or its meta charset element,
+// or nil if the document is UTF-8 or doesn't specify its encoding.
+//
+// Documents that don't specify their encoding are treated as UTF-8,
+// rather than windows-1252 as browsers do,
+// so that the undeclared UTF-8 documents common in development aren't mangled.
+func documentCharset(doc []byte, contentType string) encoding.Encoding {
+	enc, name, certain := charset.DetermineEncoding(doc, contentType)
+	if name == "utf-8" {
+		return nil
+	}
+	if !certain && name == "windows-1252" && !declaresCharset(doc) {
+		return nil
+	}
+	return enc
+}
+
+// declaresCharset reports whether the start of doc, where browsers look for it,
+// appears to contain a meta element that declares its encoding.
+func declaresCharset(doc []byte) bool {
+	if len(doc) > 1024 {
+		doc = doc[:1024]
+	}
+	return bytes.Contains(bytes.ToLower(doc), []byte("charset"))
+}
+
+// isUTF16 reports whether contentType specifies a UTF-16 charset,
+// which the script can't be injected into as bytes.
+func isUTF16(contentType string) bool {
+	_, params, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(strings.ToLower(params["charset"]), "utf-16")
+}
+
+// encodeCharset encodes the UTF-8 document doc using enc,
+// escaping the characters enc can't represent as HTML character references.
+// If enc is nil, doc is returned as-is.
+func encodeCharset(enc encoding.Encoding, doc []byte) ([]byte, error) {
+	if enc == nil {
+		return doc, nil
+	}
+	return encoding.HTMLEscapeUnsupported(enc.NewEncoder()).Bytes(doc)
+}
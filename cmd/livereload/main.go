@@ -0,0 +1,259 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Command livereload is a development server
+// that reloads the webpages open in browsers when the served program changes.
+//
+// Serve a directory, reloading the webpages whenever its files change:
+//
+//	livereload -dir ./frontend
+//
+// Proxy a webserver, reloading the webpages whenever it restarts:
+//
+//	livereload -proxy http://localhost:8080
+//
+// Build, run and proxy a Go webserver,
+// rebuilding and restarting it whenever its source files change:
+//
+//	livereload -go ./cmd/server -proxy http://localhost:8080 -- -port 8080
+//
+// Run a build command whenever the source files change,
+// reloading the webpages once it succeeds and the upstream is up:
+//
+//	livereload -build "npm run build" -proxy http://localhost:8080 -watch ./src
+//
+// Arguments after "--" are passed to the program.
+// Run "livereload -help" for the other flags.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/koonix/go-livereload"
+	"github.com/koonix/go-livereload/serve"
+	"github.com/koonix/go-livereload/supervisor"
+)
+
+func main() {
+	err := run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "livereload: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+
+	host := flag.String("host", "127.0.0.1", "comma-separated hosts to listen on; use 0.0.0.0 to expose the server on the network")
+	port := flag.String("port", "8090", "port to listen on")
+	portSearch := flag.Int("port-search", 10, "number of following ports to try if the port is unavailable")
+	dir := flag.String("dir", "", "directory to serve, reloading the webpages when its files change")
+	upstream := flag.String("proxy", "", "URL of the upstream webserver to proxy")
+	flag.StringVar(upstream, "upstream", "", "alias of -proxy")
+	goPkg := flag.String("go", "", "Go package to build, run and restart on changes; requires -proxy")
+	build := flag.String("build", "", "command to run when the watched files change, reloading the webpages once it succeeds and the -proxy upstream is up; not compatible with -go")
+	watch := flag.String("watch", "", "comma-separated directories to watch for changes; defaults to the -dir directory, or the current directory with -go")
+	eventPath := flag.String("event-path", "/livereloadevents", "path the webpages receive the reloads from")
+	basePath := flag.String("base-path", "", "path prefix the server is reachable at behind a reverse proxy, such as /app")
+	corsOrigins := flag.String("cors-origins", "", "comma-separated origins of the webpages allowed to receive the reloads from another origin, or * for any")
+	useTLS := flag.Bool("tls", false, "serve HTTPS using a self-signed certificate, unless -tls-cert is given")
+	certFile := flag.String("tls-cert", "", "certificate file for serving HTTPS; requires -tls-key")
+	keyFile := flag.String("tls-key", "", "private key file of -tls-cert")
+	qrCode := flag.Bool("qr", true, "print a QR code for opening the server on other devices")
+	lrPort := flag.Int("livereload-port", 0, fmt.Sprintf("also speak the classic LiveReload protocol on this port, usually %d, for LiveReload browser extensions and editor plugins", livereload.LiveReloadPort))
+	harFile := flag.String("har", "", "record the proxied traffic and write it to this HAR file on exit")
+	vhosts := map[string]http.Handler{}
+	flag.Func("vhost", "proxy the requests for a host pattern such as *.app.localhost to another upstream, as pattern=URL; can be repeated; requires -proxy", func(v string) error {
+		pattern, rawURL, ok := strings.Cut(v, "=")
+		if !ok {
+			return fmt.Errorf("want pattern=URL, got %q", v)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("invalid upstream URL: %w", err)
+		}
+		vhosts[pattern] = livereload.ReverseProxy(u)
+		return nil
+	})
+	flag.Parse()
+
+	if (*dir == "") == (*upstream == "") {
+		return fmt.Errorf("exactly one of the -dir and -proxy flags is required")
+	}
+	if *goPkg != "" && *upstream == "" {
+		return fmt.Errorf("the -go flag requires the -proxy flag")
+	}
+	if len(vhosts) > 0 && *upstream == "" {
+		return fmt.Errorf("the -vhost flag requires the -proxy flag")
+	}
+	if *build != "" && len(strings.Fields(*build)) == 0 {
+		return fmt.Errorf("the -build flag requires a command")
+	}
+	if *goPkg != "" && *build != "" {
+		return fmt.Errorf("the -go and -build flags can't be used together")
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		return fmt.Errorf("the -tls-cert and -tls-key flags must be given together")
+	}
+	var watchDirs []string
+	switch {
+	case *watch != "":
+		watchDirs = strings.Split(*watch, ",")
+	case *dir != "":
+		watchDirs = []string{*dir}
+	default:
+		watchDirs = []string{"."}
+	}
+	serveOptions := []serve.Option{
+		serve.WithQRCode(*qrCode),
+		serve.WithPortSearch(*portSearch),
+	}
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			return fmt.Errorf("could not load the TLS certificate: %w", err)
+		}
+		serveOptions = append(serveOptions, serve.WithCertificate(cert))
+	} else if *useTLS {
+		serveOptions = append(serveOptions, serve.WithDevCertificate())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var upstreamHandler http.Handler
+	var u *url.URL
+	if *dir != "" {
+		if _, err := os.Stat(*dir); err != nil {
+			return err
+		}
+		upstreamHandler = livereload.FileServer(http.Dir(*dir))
+	} else {
+		var err error
+		u, err = url.Parse(*upstream)
+		if err != nil {
+			return fmt.Errorf("invalid upstream URL: %w", err)
+		}
+		upstreamHandler = livereload.ReverseProxy(u)
+		if len(vhosts) > 0 {
+			if _, ok := vhosts["*"]; !ok {
+				vhosts["*"] = upstreamHandler
+			}
+			upstreamHandler = livereload.VirtualHosts(vhosts)
+		}
+	}
+	var rec *livereload.Recorder
+	if *harFile != "" {
+		rec = livereload.NewRecorder(upstreamHandler)
+		upstreamHandler = rec
+	}
+	var origins []string
+	if *corsOrigins != "" {
+		origins = strings.Split(*corsOrigins, ",")
+	}
+	// The supervisor and the runner reload the webpages themselves
+	// once the upstream is up.
+	lr := livereload.New(
+		upstreamHandler,
+		livereload.WithRestartDetection(*goPkg == "" && *build == ""),
+		livereload.WithEventPath(*eventPath),
+		livereload.WithBasePath(*basePath),
+		livereload.WithCORSOrigins(origins...),
+	)
+
+	// supervised is closed once the supervised program is stopped.
+	supervised := make(chan struct{})
+	switch {
+	case *goPkg != "":
+		s := supervisor.New(lr, *goPkg, u.Host,
+			supervisor.WithArgs(flag.Args()...),
+			supervisor.WithWatchDirs(watchDirs...),
+		)
+		go func() {
+			defer close(supervised)
+			err := s.Run(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "livereload: %s\n", err)
+			}
+		}()
+	case *build != "":
+		fields := strings.Fields(*build)
+		options := []livereload.RunnerOption{
+			livereload.WithBuildCommand(fields[0], fields[1:]...),
+		}
+		if u != nil {
+			options = append(options, livereload.WithReadyAddr(u.Host))
+		}
+		r := livereload.NewRunner(lr, options...)
+		go func() {
+			defer close(supervised)
+			go livereload.NewWatcher(lr, livereload.WithOnChange(r.Trigger)).Watch(ctx, watchDirs...)
+			r.Run(ctx)
+		}()
+	case *dir != "":
+		go func() {
+			defer close(supervised)
+			livereload.Watch(ctx, lr, watchDirs...)
+		}()
+	default:
+		close(supervised)
+	}
+
+	if *lrPort != 0 {
+		addr := net.JoinHostPort(strings.Split(*host, ",")[0], strconv.Itoa(*lrPort))
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("could not listen for the LiveReload protocol: %w", err)
+		}
+		srv := &http.Server{Handler: lr.LiveReloadProtocol()}
+		go srv.Serve(ln)
+		defer srv.Close()
+	}
+
+	addrs := listenAddrs(*host, *port)
+	err := serve.ListenAndServe(ctx, addrs[0], lr,
+		append(serveOptions, serve.WithAddrs(addrs[1:]...))...,
+	)
+	stop()
+	<-supervised
+	if rec != nil {
+		if err := writeHAR(rec, *harFile); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// listenAddrs joins the comma-separated hosts with port.
+func listenAddrs(hosts, port string) []string {
+	var addrs []string
+	for _, h := range strings.Split(hosts, ",") {
+		addrs = append(addrs, net.JoinHostPort(h, port))
+	}
+	return addrs
+}
+
+func writeHAR(rec *livereload.Recorder, name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("could not create HAR file: %w", err)
+	}
+	err = rec.WriteHAR(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write HAR file: %w", err)
+	}
+	return nil
+}
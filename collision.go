@@ -0,0 +1,104 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// detectCollision checks whether the upstream serves the event path,
+// which is shadowed by the Handler,
+// and if so, logs a warning and has the webpages log it to their console.
+//
+// Upstreams that serve every path, such as single-page application servers,
+// are told apart by comparing the response to that of a random path.
+func (h *Handler) detectCollision() {
+
+	randomPath := "/" + randomHex(8)
+
+	eventStatus := h.probeUpstream(h.eventPath)
+	if eventStatus == 0 || eventStatus == http.StatusNotFound {
+		return
+	}
+	if eventStatus == h.probeUpstream(randomPath) {
+		return
+	}
+
+	warning := fmt.Sprintf(
+		"the upstream serves the path %q, which is shadowed by the event path; "+
+			"use the livereload.WithEventPath option to choose another event path",
+		h.eventPath,
+	)
+	h.logger.Warn("livereload: " + warning)
+	h.collisionWarning.Store(&warning)
+	h.sseHandler.Publish("warning", warning)
+}
+
+// probeUpstream makes a HEAD request for path to the upstream
+// and returns the status code of the response,
+// or zero if the upstream doesn't respond in time.
+func (h *Handler) probeUpstream(path string) int {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ctx = context.WithValue(ctx, probeKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, path, nil)
+	if err != nil {
+		return 0
+	}
+	resp := &statusRecorder{
+		header: make(http.Header),
+		status: make(chan int, 1),
+	}
+	go func() {
+		defer func() {
+			if recover() != nil {
+				resp.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+		h.upstream.ServeHTTP(resp, req)
+		resp.WriteHeader(http.StatusOK)
+	}()
+
+	// Don't wait for the body; the upstream might stream it indefinitely.
+	select {
+	case status := <-resp.status:
+		return status
+	case <-ctx.Done():
+		return 0
+	}
+}
+
+// probeKey is the context key that marks the requests made by probeUpstream,
+// which aren't made by clients, and aren't recorded by [Recorder].
+type probeKey struct{}
+
+// statusRecorder is an [http.ResponseWriter]
+// that reports the status code of the response and discards the rest.
+type statusRecorder struct {
+	header      http.Header
+	status      chan int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return len(data), nil
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status <- statusCode
+}
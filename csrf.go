@@ -0,0 +1,69 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// checkTrigger returns an error if the request
+// is not allowed to publish events, such as reloads.
+//
+// Since the event path is usually served on localhost,
+// any webpage open in the browser could make requests to it.
+// Requests made by webpages of other origins are rejected,
+// which is detected using the "Sec-Fetch-Site" and "Origin" headers
+// that browsers include in their requests.
+// Requests without these headers are not made by browsers, and are allowed.
+//
+// See [WithCSRFProtection], [WithTrustedOrigins] and [WithTriggerToken].
+func (h *Handler) checkTrigger(req *http.Request) error {
+
+	if h.triggerToken != "" {
+		token := req.Header.Get("X-Livereload-Token")
+		if token == "" {
+			token = req.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.triggerToken)) != 1 {
+			return errors.New("invalid or missing token")
+		}
+	}
+
+	if !h.csrfProtection {
+		return nil
+	}
+	return h.checkOrigin(req)
+}
+
+// checkOrigin returns an error if the request
+// is made by a webpage of another origin that isn't trusted.
+func (h *Handler) checkOrigin(req *http.Request) error {
+
+	origin := req.Header.Get("Origin")
+	if origin != "" && slices.Contains(h.trustedOrigins, origin) {
+		return nil
+	}
+
+	switch req.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return nil
+	case "":
+		// Older browsers don't send Sec-Fetch-Site; fall back to Origin.
+	default:
+		return errors.New("cross-origin request rejected")
+	}
+
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != req.Host {
+		return errors.New("cross-origin request rejected")
+	}
+	return nil
+}
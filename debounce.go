@@ -0,0 +1,61 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/koonix/go-livereload/sse"
+)
+
+// reloadDebouncer holds the reloads queued by [WithReloadDebounce].
+type reloadDebouncer struct {
+	mu      sync.Mutex
+	pending []sse.Event
+	timer   *time.Timer
+}
+
+// debounceReload queues ev, and sends the queued reloads
+// once no more reloads are queued for the debounce duration.
+func (h *Handler) debounceReload(ev sse.Event) {
+	d := &h.debouncer
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !slices.Contains(d.pending, ev) {
+		d.pending = append(d.pending, ev)
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(h.reloadDebounce, h.flushReloads)
+}
+
+// flushReloads sends the queued reloads,
+// collapsing them into a full reload if any of them is one.
+func (h *Handler) flushReloads() {
+	d := &h.debouncer
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	d.timer = nil
+	d.mu.Unlock()
+
+	for _, ev := range pending {
+		if ev.Type == "wasm" {
+			h.sendReload(ev.Type, ev.Data)
+			return
+		}
+	}
+	for _, ev := range pending {
+		if ev.Type == "message" {
+			h.sendReload(ev.Type, ev.Data)
+			return
+		}
+	}
+	for _, ev := range pending {
+		h.sendReload(ev.Type, ev.Data)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decodableEncoding reports whether responses with the given Content-Encoding
+// can be decoded for injecting the script, which is the case
+// for upstreams that compress their responses despite being asked not to,
+// such as those serving precompressed files.
+func decodableEncoding(encoding string) bool {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip", "deflate", "br", "zstd":
+		return true
+	}
+	return false
+}
+
+// maxDecodedSize is the maximum size of a decoded response body,
+// beyond which it's not decoded, so that a small compressed body
+// that decodes to a huge one doesn't exhaust the memory.
+const maxDecodedSize = 64 << 20
+
+// decodeContent decodes the body of a response with the given Content-Encoding.
+// Bodies that decode to more than maxDecodedSize result in an error.
+func decodeContent(encoding string, body []byte) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, errors.New("empty body")
+	}
+	var r io.Reader = bytes.NewReader(body)
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "deflate":
+		// Despite its name, "deflate" is zlib-wrapped deflate,
+		// but some servers send raw deflate.
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			zr = flate.NewReader(bytes.NewReader(body))
+		}
+		defer zr.Close()
+		r = zr
+	case "br":
+		r = brotli.NewReader(r)
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, errors.New("unsupported encoding")
+	}
+	decoded, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > maxDecodedSize {
+		return nil, fmt.Errorf("decoded body exceeds %d bytes", maxDecodedSize)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed errorpage.html
+var errorPageTemplate string
+
+var errorPageTmpl = template.Must(template.New("errorpage").Parse(errorPageTemplate))
+
+// errorPage describes a page shown in place of the upstream response
+// when the upstream fails.
+type errorPage struct {
+	Status    int
+	Title     string
+	Message   string
+	Details   string
+	RequestID string
+}
+
+// writeErrorPage sends page downstream,
+// discarding any header set by the upstream.
+// The page includes the event listener script,
+// so it's reloaded like any other page.
+func (h *Handler) writeErrorPage(resp http.ResponseWriter, page errorPage) {
+	writeErrorPage(resp, page, h.script)
+}
+
+// writeErrorPage sends page downstream with the given script,
+// discarding any header set by the upstream.
+func writeErrorPage(resp http.ResponseWriter, page errorPage, script string) {
+	header := resp.Header()
+	clearHeader(header)
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	if page.RequestID != "" {
+		header.Set(requestIDHeader, page.RequestID)
+	}
+	resp.WriteHeader(page.Status)
+	errorPageTmpl.Execute(resp, struct {
+		errorPage
+		Script template.JS
+	}{
+		errorPage: page,
+		Script:    template.JS(script),
+	})
+}
+
+func clearHeader(h http.Header) {
+	for key := range h {
+		delete(h, key)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// FileServer returns an [http.Handler] that serves the files of root
+// like [http.FileServer] does, but serves the precompressed sibling
+// of a requested file, such as "app.js.br" or "app.js.gz" for "app.js",
+// if there's one and the client accepts its encoding,
+// like production static file hosts do.
+//
+// When used as the upstream of [New],
+// HTML files are served uncompressed,
+// since the script can't be injected into compressed responses.
+func FileServer(root http.FileSystem) http.Handler {
+	return &fileServer{
+		root:       root,
+		fileServer: http.FileServer(root),
+	}
+}
+
+type fileServer struct {
+	root       http.FileSystem
+	fileServer http.Handler
+}
+
+// precompressed lists the extensions of the precompressed files
+// and their encodings, in the order of preference.
+var precompressed = []struct {
+	ext      string
+	encoding string
+}{
+	{".br", "br"},
+	{".gz", "gzip"},
+}
+
+// acceptEncodingKey is the context key of the original Accept-Encoding header
+// of the requests that [Handler] passes to the upstream,
+// since it replaces the header with "identity".
+type acceptEncodingKey struct{}
+
+func (s *fileServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+
+	name := path.Clean("/" + req.URL.Path)
+	typ := mime.TypeByExtension(path.Ext(name))
+	if strings.HasSuffix(req.URL.Path, "/") || typ == "" {
+		s.fileServer.ServeHTTP(resp, req)
+		return
+	}
+
+	accept := req.Header.Get("Accept-Encoding")
+	if v, ok := req.Context().Value(acceptEncodingKey{}).(string); ok {
+		mediaType, _, _ := mime.ParseMediaType(typ)
+		if mediaType == "text/html" || mediaType == "text/plain" {
+			s.fileServer.ServeHTTP(resp, req)
+			return
+		}
+		accept = v
+	}
+
+	vary := false
+	for _, pc := range precompressed {
+		f, err := s.root.Open(name + pc.ext)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil || stat.IsDir() {
+			continue
+		}
+		if !vary {
+			resp.Header().Add("Vary", "Accept-Encoding")
+			vary = true
+		}
+		if !acceptsEncoding(accept, pc.encoding) {
+			continue
+		}
+		resp.Header().Set("Content-Type", typ)
+		resp.Header().Set("Content-Encoding", pc.encoding)
+		http.ServeContent(resp, req, name, stat.ModTime(), f)
+		return
+	}
+
+	s.fileServer.ServeHTTP(resp, req)
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header value accept
+// includes the given encoding, with a non-zero quality value.
+func acceptsEncoding(accept, encoding string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), encoding) {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		return !ok || strings.Trim(q, "0.") != ""
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// shouldInject reports whether the script may be injected
+// into the response to req, as configured using
+// [WithInjectFilter] and [WithSkipPaths].
+func (h *Handler) shouldInject(req *http.Request) bool {
+	for _, pattern := range h.skipPaths {
+		if matchPath(pattern, req.URL.Path) {
+			return false
+		}
+	}
+	if h.injectFilter != nil {
+		return h.injectFilter(req)
+	}
+	return defaultInjectFilter(req)
+}
+
+// defaultInjectFilter skips the responses to requests made using fetch or XMLHttpRequest,
+// such as HTML fragments that are inserted into the webpages,
+// which browsers mark using the "Sec-Fetch-Dest" header.
+func defaultInjectFilter(req *http.Request) bool {
+	return req.Header.Get("Sec-Fetch-Dest") != "empty"
+}
+
+// matchPath reports whether the URL path p matches pattern,
+// which has the syntax of [path.Match],
+// or matches the paths under it if it ends in a slash.
+func matchPath(pattern, p string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/"); ok {
+		for ; ; p = path.Dir(p) {
+			if ok, _ := path.Match(dir, p); ok {
+				return true
+			}
+			if p == "/" || p == "." {
+				return dir == ""
+			}
+		}
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxGhostEventSize is the maximum size of the interactions
+// reported by webpages in ghost mode.
+const maxGhostEventSize = 64 << 10
+
+// ghostPath returns the path webpages report their interactions to
+// in ghost mode.
+func (h *Handler) ghostPath() string {
+	return h.eventPath + "/ghost"
+}
+
+// serveGhost broadcasts an interaction reported by a webpage
+// to all webpages, as a "ghost" event.
+// The interaction is opaque JSON, interpreted only by the webpages.
+func (h *Handler) serveGhost(resp http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodPost {
+		msg := fmt.Sprintf("method not allowed: %q", req.Method)
+		http.Error(resp, msg, http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := h.checkTrigger(req)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(resp, req.Body, maxGhostEventSize))
+	if err != nil {
+		err := fmt.Errorf("could not read request body: %w", err)
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Compacting removes the newlines,
+	// which would otherwise split the event data.
+	buf := new(bytes.Buffer)
+	err = json.Compact(buf, data)
+	if err != nil {
+		err := fmt.Errorf("invalid interaction: %w", err)
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.sseHandler.PublishTransient("ghost", buf.String())
+	resp.WriteHeader(http.StatusNoContent)
+}
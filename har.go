@@ -0,0 +1,412 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Recorder is an [http.Handler] that records the requests
+// it passes to its upstream and the responses,
+// which can be exported as a [HAR] file
+// or replayed against another upstream,
+// such as for finding out why a site behaves differently through the proxy.
+//
+// It's used as the upstream of [New]:
+//
+//	rec := livereload.NewRecorder(livereload.ReverseProxy(u))
+//	lr := livereload.New(rec)
+//	...
+//	rec.WriteHAR(f)
+//
+// The recorded requests are the ones the upstream receives,
+// which differ from the ones the browser makes in the Accept-Encoding header,
+// and the recorded HTML responses are the ones before the script is injected.
+//
+// [HAR]: https://w3c.github.io/web-performance/specs/HAR/Overview.html
+type Recorder struct {
+	upstream   http.Handler
+	bodies     bool
+	maxEntries int
+
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// NewRecorder creates a [Recorder] that records the traffic of upstream.
+func NewRecorder(upstream http.Handler, options ...RecorderOption) *Recorder {
+	r := &Recorder{
+		upstream:   upstream,
+		maxEntries: 1000,
+	}
+	for _, fn := range options {
+		fn(r)
+	}
+	return r
+}
+
+func (r *Recorder) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+
+	if req.Context().Value(probeKey{}) != nil {
+		r.upstream.ServeHTTP(resp, req)
+		return
+	}
+
+	start := time.Now()
+	entry := harEntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         requestURL(req),
+			HTTPVersion: req.Proto,
+			Cookies:     []any{},
+			Headers:     harHeaders(req.Header),
+			QueryString: harQuery(req),
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Cache: struct{}{},
+	}
+	if r.bodies && req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if err == nil {
+			text, encoding := harText(body)
+			entry.Request.BodySize = len(body)
+			entry.Request.PostData = &harPostData{
+				MimeType: req.Header.Get("Content-Type"),
+				Text:     text,
+				Encoding: encoding,
+			}
+		}
+	}
+
+	rw := &recordingWriter{ResponseWriter: resp, start: start, bodies: r.bodies}
+	defer func() {
+		// Record the requests whose handling panics, too.
+		r.record(entry, rw)
+	}()
+	r.upstream.ServeHTTP(rw, req)
+}
+
+func (r *Recorder) record(entry harEntry, rw *recordingWriter) {
+
+	end := time.Now()
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+		rw.header = rw.Header().Clone()
+		rw.wait = end.Sub(rw.start)
+	}
+
+	entry.Response = harResponse{
+		Status:      rw.status,
+		StatusText:  http.StatusText(rw.status),
+		HTTPVersion: entry.Request.HTTPVersion,
+		Cookies:     []any{},
+		Headers:     harHeaders(rw.header),
+		Content: harContent{
+			Size:     rw.size,
+			MimeType: rw.header.Get("Content-Type"),
+		},
+		RedirectURL: rw.header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    rw.size,
+	}
+	if rw.bodies {
+		entry.Response.Content.Text, entry.Response.Content.Encoding = harText(rw.body.Bytes())
+	}
+	entry.Timings = harTimings{
+		Send:    0,
+		Wait:    milliseconds(rw.wait),
+		Receive: milliseconds(end.Sub(rw.start) - rw.wait),
+	}
+	entry.Time = milliseconds(end.Sub(rw.start))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	if len(r.entries) > r.maxEntries {
+		r.entries = r.entries[len(r.entries)-r.maxEntries:]
+	}
+}
+
+// WriteHAR writes the recorded traffic to w in the HAR format.
+func (r *Recorder) WriteHAR(w io.Writer) error {
+	r.mu.Lock()
+	entries := append([]harEntry{}, r.entries...)
+	r.mu.Unlock()
+
+	var doc harDocument
+	doc.Log.Version = "1.2"
+	doc.Log.Creator.Name = "go-livereload"
+	doc.Log.Creator.Version = "1"
+	doc.Log.Entries = entries
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Reset discards the recorded traffic.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
+
+// Replay makes the recorded requests to upstream in order,
+// and returns a [Recorder] with the same options that has recorded them,
+// whose HAR can be compared with the one of r.
+// Unless r records bodies, the requests are replayed without their bodies.
+func (r *Recorder) Replay(ctx context.Context, upstream http.Handler) (*Recorder, error) {
+
+	r.mu.Lock()
+	entries := append([]harEntry{}, r.entries...)
+	r.mu.Unlock()
+
+	replay := &Recorder{
+		upstream:   upstream,
+		bodies:     r.bodies,
+		maxEntries: r.maxEntries,
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return replay, err
+		}
+		var body io.Reader
+		if pd := entry.Request.PostData; pd != nil {
+			b := []byte(pd.Text)
+			if pd.Encoding == "base64" {
+				b, _ = base64.StdEncoding.DecodeString(pd.Text)
+			}
+			body = bytes.NewReader(b)
+		}
+		req, err := http.NewRequestWithContext(ctx, entry.Request.Method, entry.Request.URL, body)
+		if err != nil {
+			return replay, err
+		}
+		for _, h := range entry.Request.Headers {
+			req.Header.Add(h.Name, h.Value)
+		}
+		req.RequestURI = req.URL.RequestURI()
+		replay.ServeHTTP(&discardWriter{header: make(http.Header)}, req)
+	}
+	return replay, nil
+}
+
+func (r *Recorder) watchRestarts(ctx context.Context, fn func()) {
+	if rw, ok := r.upstream.(restartWatcher); ok {
+		rw.watchRestarts(ctx, fn)
+	}
+}
+
+// ==========
+
+type RecorderOption func(r *Recorder)
+
+// WithRecordBodies configures whether to record
+// the bodies of the requests and the responses,
+// which are kept in memory.
+//
+// Defaults to false.
+func WithRecordBodies(v bool) RecorderOption {
+	return func(r *Recorder) {
+		r.bodies = v
+	}
+}
+
+// WithMaxEntries sets how many of the most recent requests are kept.
+//
+// Defaults to 1000.
+func WithMaxEntries(n int) RecorderOption {
+	return func(r *Recorder) {
+		r.maxEntries = max(n, 1)
+	}
+}
+
+// ==========
+
+// recordingWriter records a response as it's written.
+type recordingWriter struct {
+	http.ResponseWriter
+	start  time.Time
+	bodies bool
+
+	status int
+	header http.Header
+	wait   time.Duration
+	size   int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = w.Header().Clone()
+		w.wait = time.Since(w.start)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := w.ResponseWriter.Write(p)
+	w.size += n
+	if w.bodies {
+		w.body.Write(p[:n])
+	}
+	return n, err
+}
+
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// discardWriter is the response writer of the replayed requests.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// ==========
+
+func requestURL(req *http.Request) string {
+	if req.URL.IsAbs() {
+		return req.URL.String()
+	}
+	u := *req.URL
+	u.Scheme = "http"
+	if req.TLS != nil {
+		u.Scheme = "https"
+	}
+	u.Host = req.Host
+	return u.String()
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	nv := []harNameValue{}
+	for name, values := range header {
+		for _, v := range values {
+			nv = append(nv, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(nv, func(i, j int) bool {
+		return nv[i].Name < nv[j].Name
+	})
+	return nv
+}
+
+func harQuery(req *http.Request) []harNameValue {
+	nv := []harNameValue{}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			nv = append(nv, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(nv, func(i, j int) bool {
+		return nv[i].Name < nv[j].Name
+	})
+	return nv
+}
+
+// harText returns body as text, base64-encoding it if it's not valid UTF-8.
+func harText(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type harDocument struct {
+	Log struct {
+		Version string `json:"version"`
+		Creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []any          `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []any          `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+
+	// Encoding isn't part of the HAR format,
+	// but is used like the one of harContent for binary bodies.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
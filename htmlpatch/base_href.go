@@ -0,0 +1,44 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"golang.org/x/net/html"
+)
+
+// SetBaseHref returns a copy of inputHTML
+// whose relative URLs resolve against href.
+//
+// The href attribute of the document's base tag is set to href,
+// or if it has none, a base tag is inserted at the start of the head tag,
+// before any elements whose URLs it affects.
+func SetBaseHref(inputHTML []byte, href string) (outputHTML []byte, err error) {
+
+	return patch(inputHTML, func(doc *html.Node) error {
+
+		// Browsers only use the first base tag with an href attribute.
+		bases := FindAll(doc, Selector{Tag: "base", Attr: "href"})
+		if len(bases) > 0 {
+			for i, attr := range bases[0].Attr {
+				if attr.Key == "href" {
+					bases[0].Attr[i].Val = href
+				}
+			}
+			return nil
+		}
+
+		// Find or create the head tag.
+		htmlTag := findOrCreateHtmlTag(doc)
+		headTag := findOrCreateHeadTag(htmlTag)
+
+		// Create and insert the base tag.
+		prependChild(headTag, &html.Node{
+			Type: html.ElementNode,
+			Data: "base",
+			Attr: []html.Attribute{{Key: "href", Val: href}},
+		})
+
+		return nil
+	})
+}
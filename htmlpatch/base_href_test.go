@@ -0,0 +1,47 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch_test
+
+import (
+	"testing"
+
+	"github.com/koonix/go-livereload/htmlpatch"
+)
+
+func TestSetBaseHref(t *testing.T) {
+	tests := []struct {
+		name       string
+		inputHTML  string
+		outputHTML string
+	}{
+		{
+			"blank",
+			``,
+			`<!DOCTYPE html><html><head><base href="/app/"/></head><body></body></html>`,
+		},
+		{
+			"first-in-head",
+			`<html><head><link rel="stylesheet" href="style.css"/></head><body>lmao</body></html>`,
+			`<!DOCTYPE html><html><head><base href="/app/"/><link rel="stylesheet" href="style.css"/></head><body>lmao</body></html>`,
+		},
+		{
+			"rewrite",
+			`<html><head><base target="_blank"/><base href="/"/><base href="/other/"/></head><body>lmao</body></html>`,
+			`<html><head><base target="_blank"/><base href="/app/"/><base href="/other/"/></head><body>lmao</body></html>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputHTML, err := htmlpatch.SetBaseHref([]byte(test.inputHTML), "/app/")
+			if err != nil {
+				t.Fatalf("could not set the base href of HTML: %s", err)
+			}
+			want := test.outputHTML
+			got := string(outputHTML)
+			if want != got {
+				t.Errorf("incorrect output html; want %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package htmlpatch provides functionality for modifying HTML documents,
+// such as inserting scripts and removing or replacing elements.
+//
+// Documents are parsed and rendered using [golang.org/x/net/html],
+// so missing elements like the head tag are added as needed.
+package htmlpatch
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/net/html"
+)
+
+// patch parses inputHTML, modifies it using fn and renders it.
+func patch(inputHTML []byte, fn func(doc *html.Node) error) (outputHTML []byte, err error) {
+
+	doc, err := html.Parse(bytes.NewReader(inputHTML))
+	if err != nil {
+		return inputHTML, fmt.Errorf("could not parse HTML: %w", err)
+	}
+
+	err = fn(doc)
+	if err != nil {
+		return inputHTML, err
+	}
+
+	buf := new(bytes.Buffer)
+	err = html.Render(buf, doc)
+	if err != nil {
+		return inputHTML, fmt.Errorf("error rendering HTML: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// insertIntoHead returns a copy of inputHTML
+// with node inserted at the end of the head tag of the HTML,
+// splicing it in if the document needs it.
+func insertIntoHead(inputHTML []byte, node *html.Node) (outputHTML []byte, err error) {
+
+	if needsSplicing(inputHTML) {
+		return spliceNode(addMissingStartTags(inputHTML), node)
+	}
+
+	return patch(inputHTML, func(doc *html.Node) error {
+
+		// Find or create the head tag.
+		htmlTag := findOrCreateHtmlTag(doc)
+		headTag := findOrCreateHeadTag(htmlTag)
+
+		// Insert the node.
+		headTag.AppendChild(node)
+
+		return nil
+	})
+}
+
+func findOrCreateHtmlTag(doc *html.Node) (htmlTag *html.Node) {
+
+	htmlTag = findFirstTag(doc, "html")
+
+	if htmlTag == nil {
+		htmlTag = &html.Node{
+			Type: html.ElementNode,
+			Data: "html",
+		}
+		doc.AppendChild(htmlTag)
+	}
+
+	doctype := findDoctype(doc)
+
+	if doctype == nil {
+		doctype = &html.Node{
+			Type: html.DoctypeNode,
+			Data: "html",
+		}
+		prependChild(doc, doctype)
+	}
+
+	return htmlTag
+}
+
+func findOrCreateHeadTag(htmlTag *html.Node) (headTag *html.Node) {
+
+	headTag = findFirstTag(htmlTag, "head")
+
+	if headTag == nil {
+		headTag = &html.Node{
+			Type: html.ElementNode,
+			Data: "head",
+		}
+		prependChild(htmlTag, headTag)
+	}
+
+	return headTag
+}
+
+func findOrCreateBodyTag(htmlTag *html.Node) (bodyTag *html.Node) {
+
+	bodyTag = findFirstTag(htmlTag, "body")
+
+	if bodyTag == nil {
+		bodyTag = &html.Node{
+			Type: html.ElementNode,
+			Data: "body",
+		}
+		htmlTag.AppendChild(bodyTag)
+	}
+
+	return bodyTag
+}
+
+func findFirstTag(node *html.Node, tagName string) *html.Node {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == tagName {
+			return child
+		}
+	}
+	return nil
+}
+
+func findDoctype(doc *html.Node) *html.Node {
+	for child := doc.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.DoctypeNode {
+			return child
+		}
+	}
+	return nil
+}
+
+func prependChild(node, child *html.Node) {
+	if node.FirstChild == nil {
+		node.AppendChild(child)
+	} else {
+		node.InsertBefore(child, node.FirstChild)
+	}
+}
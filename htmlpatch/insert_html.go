@@ -0,0 +1,91 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Position is a position in an HTML document to insert HTML at.
+type Position int
+
+const (
+	// HeadEnd is at the end of the head tag,
+	// suitable for meta, link, style and script tags.
+	HeadEnd Position = iota
+
+	// BodyStart is at the start of the body tag.
+	BodyStart
+
+	// BodyEnd is at the end of the body tag,
+	// suitable for elements that should be on top of the webpage,
+	// such as toolbars.
+	BodyEnd
+)
+
+// SpliceHTML returns a copy of inputHTML
+// with snippetHTML inserted at pos,
+// leaving the rest of the document byte-for-byte identical.
+// Like with [SpliceScript], the document is never parsed and rendered.
+func SpliceHTML(inputHTML []byte, pos Position, snippetHTML string) (outputHTML []byte, err error) {
+	switch pos {
+	case HeadEnd:
+		return splice(inputHTML, headEnd(inputHTML), []byte(snippetHTML)), nil
+	case BodyStart:
+		return splice(inputHTML, bodyStart(inputHTML), []byte(snippetHTML)), nil
+	case BodyEnd:
+		return splice(inputHTML, bodyEnd(inputHTML), []byte(snippetHTML)), nil
+	}
+	return inputHTML, fmt.Errorf("invalid position %d", pos)
+}
+
+// InsertHTML returns a copy of inputHTML
+// with snippetHTML inserted at pos.
+//
+// Like with [InsertScript], documents that the parse and render cycle
+// might not preserve are left byte-for-byte identical
+// apart from the inserted snippet and the start tags of missing elements.
+func InsertHTML(inputHTML []byte, pos Position, snippetHTML string) (outputHTML []byte, err error) {
+
+	if needsSplicing(inputHTML) {
+		return SpliceHTML(addMissingStartTags(inputHTML), pos, snippetHTML)
+	}
+
+	return patch(inputHTML, func(doc *html.Node) error {
+
+		// Find or create the head or body tag.
+		htmlTag := findOrCreateHtmlTag(doc)
+		var parent *html.Node
+		switch pos {
+		case HeadEnd:
+			parent = findOrCreateHeadTag(htmlTag)
+		case BodyStart, BodyEnd:
+			parent = findOrCreateBodyTag(htmlTag)
+		default:
+			return fmt.Errorf("invalid position %d", pos)
+		}
+
+		// Parse the snippet in the context of its parent,
+		// so that elements like meta tags are parsed correctly.
+		nodes, err := html.ParseFragment(strings.NewReader(snippetHTML), parent)
+		if err != nil {
+			return fmt.Errorf("could not parse snippet HTML: %w", err)
+		}
+
+		// Insert the snippet.
+		first := parent.FirstChild
+		for _, n := range nodes {
+			if pos == BodyStart && first != nil {
+				parent.InsertBefore(n, first)
+			} else {
+				parent.AppendChild(n)
+			}
+		}
+
+		return nil
+	})
+}
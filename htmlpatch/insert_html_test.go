@@ -0,0 +1,90 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch_test
+
+import (
+	"testing"
+
+	"github.com/koonix/go-livereload/htmlpatch"
+)
+
+func TestInsertHTML(t *testing.T) {
+	tests := []struct {
+		name       string
+		pos        htmlpatch.Position
+		snippet    string
+		inputHTML  string
+		outputHTML string
+	}{
+		{
+			"head-end",
+			htmlpatch.HeadEnd,
+			`<meta name="robots" content="noindex">`,
+			`<html><head><title>t</title></head><body>lmao</body></html>`,
+			`<!DOCTYPE html><html><head><title>t</title><meta name="robots" content="noindex"/></head><body>lmao</body></html>`,
+		},
+		{
+			"body-start",
+			htmlpatch.BodyStart,
+			`<div id="a"></div><div id="b"></div>`,
+			`<p>lmao</p>`,
+			`<!DOCTYPE html><html><head></head><body><div id="a"></div><div id="b"></div><p>lmao</p></body></html>`,
+		},
+		{
+			"body-end",
+			htmlpatch.BodyEnd,
+			`<div id="toolbar"></div>`,
+			`<p>lmao</p>`,
+			`<!DOCTYPE html><html><head></head><body><p>lmao</p><div id="toolbar"></div></body></html>`,
+		},
+		{
+			"spliced-head-end",
+			htmlpatch.HeadEnd,
+			`<meta name="robots" content="noindex">`,
+			`<!-- c --><head><title>t</title></head><body>lmao</body>`,
+			`<!-- c --><html><head><title>t</title><meta name="robots" content="noindex"></head><body>lmao</body>`,
+		},
+		{
+			"spliced-body-start",
+			htmlpatch.BodyStart,
+			`<div></div>`,
+			`<!-- c --><head><script>"<body>"</script></head><body class=a>lmao</body>`,
+			`<!-- c --><html><head><script>"<body>"</script></head><body class=a><div></div>lmao</body>`,
+		},
+		{
+			"spliced-body-start-implicit",
+			htmlpatch.BodyStart,
+			`<div></div>`,
+			`<!-- c --><head><title>t</title></head> <p>lmao`,
+			`<!-- c --><html><head><title>t</title></head><body><div></div> <p>lmao`,
+		},
+		{
+			"spliced-body-end",
+			htmlpatch.BodyEnd,
+			`<div></div>`,
+			`<!-- c --><body><script>"</body>"</script></body></html><!-- d -->`,
+			`<!-- c --><html><head><body><script>"</body>"</script><div></div></body></html><!-- d -->`,
+		},
+		{
+			"spliced-body-end-implicit",
+			htmlpatch.BodyEnd,
+			`<div></div>`,
+			`<!-- c --><p>lmao`,
+			`<!-- c --><html><head><body><p>lmao<div></div>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputHTML, err := htmlpatch.InsertHTML([]byte(test.inputHTML), test.pos, test.snippet)
+			if err != nil {
+				t.Fatalf("could not insert snippet into HTML: %s", err)
+			}
+			want := test.outputHTML
+			got := string(outputHTML)
+			if want != got {
+				t.Errorf("incorrect output html; want %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"golang.org/x/net/html"
+)
+
+// InsertNoscript returns a copy of inputHTML
+// with a noscript tag containing contentHTML
+// inserted at the end of the head tag of the HTML.
+// Noscript tags in the head may only contain link, style and meta tags.
+//
+// Like with [InsertScript], documents that the parse and render cycle
+// might not preserve are left byte-for-byte identical
+// apart from the inserted tag and the start tags of missing elements.
+func InsertNoscript(inputHTML []byte, contentHTML string) (outputHTML []byte, err error) {
+
+	// The contents of noscript tags are rendered as-is.
+	noscript := &html.Node{
+		Type: html.ElementNode,
+		Data: "noscript",
+	}
+	if contentHTML != "" {
+		noscript.AppendChild(&html.Node{
+			Type: html.TextNode,
+			Data: contentHTML,
+		})
+	}
+
+	return insertIntoHead(inputHTML, noscript)
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch_test
+
+import (
+	"testing"
+
+	"github.com/koonix/go-livereload/htmlpatch"
+)
+
+func TestInsertNoscript(t *testing.T) {
+	tests := []struct {
+		name       string
+		inputHTML  string
+		outputHTML string
+	}{
+		{
+			"blank",
+			``,
+			`<!DOCTYPE html><html><head><noscript><meta http-equiv="refresh" content="2"></noscript></head><body></body></html>`,
+		},
+		{
+			"full",
+			`<!DOCTYPE html><html><head><title>t</title></head><body>lmao</body></html>`,
+			`<!DOCTYPE html><html><head><title>t</title><noscript><meta http-equiv="refresh" content="2"></noscript></head><body>lmao</body></html>`,
+		},
+		{
+			"spliced",
+			`<!-- c --><head><title>t</title></head>`,
+			`<!-- c --><html><head><title>t</title><noscript><meta http-equiv="refresh" content="2"></noscript></head><body>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputHTML, err := htmlpatch.InsertNoscript(
+				[]byte(test.inputHTML),
+				`<meta http-equiv="refresh" content="2">`,
+			)
+			if err != nil {
+				t.Fatalf("could not insert noscript into HTML: %s", err)
+			}
+			want := test.outputHTML
+			got := string(outputHTML)
+			if want != got {
+				t.Errorf("incorrect output html; want %q, got %q", want, got)
+			}
+		})
+	}
+}
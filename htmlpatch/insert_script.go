@@ -0,0 +1,65 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"golang.org/x/net/html"
+)
+
+// InsertScript returns a copy of inputHTML
+// with a script tag inserted at the end of the head tag of the HTML.
+//
+// Documents containing comments, template elements or custom elements
+// are left byte-for-byte identical apart from the inserted script tag
+// and the start tags of their missing html, head and body elements,
+// preserving conditional comments, templating markers in comments,
+// and the markup of web components.
+// Other documents are parsed and rendered, adding missing elements
+// and the doctype.
+func InsertScript(
+	inputHTML []byte,
+	scriptAttrs []html.Attribute,
+	scriptContent string,
+) (
+	outputHTML []byte,
+	err error,
+) {
+
+	return insertIntoHead(inputHTML, scriptTag(scriptAttrs, scriptContent))
+}
+
+// SpliceScript returns a copy of inputHTML
+// with a script tag inserted at the end of the head tag of the HTML,
+// leaving the rest of the document byte-for-byte identical,
+// such as its attribute quoting, self-closing tags and whitespace.
+//
+// Unlike [InsertScript], the document is never parsed and rendered.
+// The insertion point is located using the tokenizer,
+// and missing elements are not added; browsers create them implicitly.
+func SpliceScript(
+	inputHTML []byte,
+	scriptAttrs []html.Attribute,
+	scriptContent string,
+) (
+	outputHTML []byte,
+	err error,
+) {
+
+	return spliceNode(inputHTML, scriptTag(scriptAttrs, scriptContent))
+}
+
+func scriptTag(attrs []html.Attribute, content string) *html.Node {
+	script := &html.Node{
+		Type: html.ElementNode,
+		Data: "script",
+		Attr: attrs,
+	}
+	if content != "" {
+		script.AppendChild(&html.Node{
+			Type: html.TextNode,
+			Data: content,
+		})
+	}
+	return script
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch_test
+
+import (
+	"testing"
+
+	"github.com/koonix/go-livereload/htmlpatch"
+)
+
+func TestInsertScript(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		inputHTML  string
+		outputHTML string
+	}{
+		{
+			"blank",
+			`myscript`,
+			``,
+			`<!DOCTYPE html><html><head><script>myscript</script></head><body></body></html>`,
+		},
+		{
+			"orphan-text",
+			`myscript`,
+			`mytext`,
+			`<!DOCTYPE html><html><head><script>myscript</script></head><body>mytext</body></html>`,
+		},
+		{
+			"orphan-tag",
+			`myscript`,
+			`<p>myparagraph</p>`,
+			`<!DOCTYPE html><html><head><script>myscript</script></head><body><p>myparagraph</p></body></html>`,
+		},
+		{
+			"orphan-body",
+			`myscript`,
+			`<body key="value">mytext</body>`,
+			`<!DOCTYPE html><html><head><script>myscript</script></head><body key="value">mytext</body></html>`,
+		},
+		{
+			"no-head",
+			`myscript`,
+			`<html key="value"><body>lmao</body></html>`,
+			`<!DOCTYPE html><html key="value"><head><script>myscript</script></head><body>lmao</body></html>`,
+		},
+		{
+			"no-doctype",
+			`myscript`,
+			`<html key="value"><head key2="value2"><meta key3="value3"/></head><body>lmao</body></html>`,
+			`<!DOCTYPE html><html key="value"><head key2="value2"><meta key3="value3"/><script>myscript</script></head><body>lmao</body></html>`,
+		},
+		{
+			"full",
+			`myscript`,
+			`<!DOCTYPE mydoctype><html key="value"><head key2="value2"><meta key3="value3"/></head><body>lmao</body></html>`,
+			`<!DOCTYPE mydoctype><html key="value"><head key2="value2"><meta key3="value3"/><script>myscript</script></head><body>lmao</body></html>`,
+		},
+		{
+			"conditional-comment",
+			`myscript`,
+			`<!DOCTYPE html><html><head><!--[if IE]><link href=ie.css><![endif]--></head><body><![if !IE]><p>x</p><![endif]></body></html>`,
+			`<!DOCTYPE html><html><head><!--[if IE]><link href=ie.css><![endif]--><script>myscript</script></head><body><![if !IE]><p>x</p><![endif]></body></html>`,
+		},
+		{
+			"template-comment",
+			`myscript`,
+			`<html><body><!-- ko if: a < b && c --><p>x</p><!-- /ko --></body></html>`,
+			`<html><head><script>myscript</script><body><!-- ko if: a < b && c --><p>x</p><!-- /ko --></body></html>`,
+		},
+		{
+			"comment-no-head-end",
+			`myscript`,
+			`<!-- c --><head><title></head></title><style></head></style>  <p>x`,
+			`<!-- c --><html><head><title></head></title><style></head></style>  <script>myscript</script><body><p>x`,
+		},
+		{
+			"template",
+			`myscript`,
+			`<html><head><template id=t><style>:host{}</style><slot></slot></template></head><body><table><template><tr><td>1</td></tr></template></table></body></html>`,
+			`<html><head><template id=t><style>:host{}</style><slot></slot></template><script>myscript</script></head><body><table><template><tr><td>1</td></tr></template></table></body></html>`,
+		},
+		{
+			"declarative-shadow-dom",
+			`myscript`,
+			`<!DOCTYPE html><html><head></head><body><my-card><template shadowrootmode="open"><p><slot></slot></p></template>x</my-card></body></html>`,
+			`<!DOCTYPE html><html><head><script>myscript</script></head><body><my-card><template shadowrootmode="open"><p><slot></slot></p></template>x</my-card></body></html>`,
+		},
+		{
+			"custom-elements-self-closing",
+			`myscript`,
+			`<!DOCTYPE html><html><head></head><body><my-app/><x-icon name=a /></body></html>`,
+			`<!DOCTYPE html><html><head><script>myscript</script></head><body><my-app/><x-icon name=a /></body></html>`,
+		},
+		{
+			"custom-elements-in-table",
+			`myscript`,
+			`<!DOCTYPE html><html><head></head><body><table><my-row :key="id" @click="select"></my-row></table></body></html>`,
+			`<!DOCTYPE html><html><head><script>myscript</script></head><body><table><my-row :key="id" @click="select"></my-row></table></body></html>`,
+		},
+		{
+			"custom-elements-bindings",
+			`myscript`,
+			`<!DOCTYPE html><html><head><meta charset=utf-8></head><body><lit-el .items=${items} ?hidden=${h}></lit-el><ion-button [disabled]=busy (click)=save()>Save</ion-button></body></html>`,
+			`<!DOCTYPE html><html><head><meta charset=utf-8><script>myscript</script></head><body><lit-el .items=${items} ?hidden=${h}></lit-el><ion-button [disabled]=busy (click)=save()>Save</ion-button></body></html>`,
+		},
+		{
+			"comment-complete",
+			`myscript`,
+			"<!DOCTYPE html><!-- c -->\n<html lang=en>\n<head><title>t</title></head>\n<body><p>x</body></html>",
+			"<!DOCTYPE html><!-- c -->\n<html lang=en>\n<head><title>t</title><script>myscript</script></head>\n<body><p>x</body></html>",
+		},
+		{
+			"comment-bom",
+			`myscript`,
+			"\xef\xbb\xbf<!-- c -->\n<title>t</title>",
+			"\xef\xbb\xbf<!-- c -->\n<html><head><title>t</title><script>myscript</script><body>",
+		},
+		{
+			"xml-declaration",
+			`myscript`,
+			`<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>t</title></head><body></body></html>`,
+			`<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>t</title><script>myscript</script></head><body></body></html>`,
+		},
+		{
+			"comment-orphan-text",
+			`myscript`,
+			`<!-- c -->mytext`,
+			`<!-- c --><html><head><script>myscript</script><body>mytext`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputHTML, err := htmlpatch.InsertScript(
+				[]byte(test.inputHTML),
+				nil,
+				test.script,
+			)
+			if err != nil {
+				t.Fatalf("could not insert script into HTML: %s", err)
+			}
+			want := test.outputHTML
+			got := string(outputHTML)
+			if want != got {
+				t.Errorf("incorrect output html; want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestSpliceScript(t *testing.T) {
+	tests := []struct {
+		name       string
+		inputHTML  string
+		outputHTML string
+	}{
+		{
+			"blank",
+			``,
+			`<script>myscript</script>`,
+		},
+		{
+			"no-head",
+			`<html key='value'><body>lmao</body></html>`,
+			`<html key='value'><script>myscript</script><body>lmao</body></html>`,
+		},
+		{
+			"markup",
+			"<!doctype html>\n<html lang=en>\n<head>\n  <meta charset=utf-8>\n  <link rel=stylesheet href='a.css' />\n</head>\n<body><br/><img src=x alt=''></body>\n</html>\n",
+			"<!doctype html>\n<html lang=en>\n<head>\n  <meta charset=utf-8>\n  <link rel=stylesheet href='a.css' />\n<script>myscript</script></head>\n<body><br/><img src=x alt=''></body>\n</html>\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputHTML, err := htmlpatch.SpliceScript([]byte(test.inputHTML), nil, "myscript")
+			if err != nil {
+				t.Fatalf("could not splice script into HTML: %s", err)
+			}
+			if got := string(outputHTML); got != test.outputHTML {
+				t.Errorf("incorrect output html; want %q, got %q", test.outputHTML, got)
+			}
+		})
+	}
+}
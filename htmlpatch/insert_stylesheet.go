@@ -0,0 +1,65 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"golang.org/x/net/html"
+)
+
+// InsertStylesheet returns a copy of inputHTML
+// with a link tag referencing the stylesheet at href
+// inserted at the end of the head tag of the HTML.
+//
+// Like with [InsertScript], documents that the parse and render cycle
+// might not preserve are left byte-for-byte identical
+// apart from the inserted tag and the start tags of missing elements.
+func InsertStylesheet(
+	inputHTML []byte,
+	linkAttrs []html.Attribute,
+	href string,
+) (
+	outputHTML []byte,
+	err error,
+) {
+
+	attrs := append([]html.Attribute{
+		{Key: "rel", Val: "stylesheet"},
+		{Key: "href", Val: href},
+	}, linkAttrs...)
+	return insertIntoHead(inputHTML, &html.Node{
+		Type: html.ElementNode,
+		Data: "link",
+		Attr: attrs,
+	})
+}
+
+// InsertStyle returns a copy of inputHTML
+// with a style tag containing cssText
+// inserted at the end of the head tag of the HTML.
+//
+// Like with [InsertScript], documents that the parse and render cycle
+// might not preserve are left byte-for-byte identical
+// apart from the inserted tag and the start tags of missing elements.
+func InsertStyle(
+	inputHTML []byte,
+	styleAttrs []html.Attribute,
+	cssText string,
+) (
+	outputHTML []byte,
+	err error,
+) {
+
+	style := &html.Node{
+		Type: html.ElementNode,
+		Data: "style",
+		Attr: styleAttrs,
+	}
+	if cssText != "" {
+		style.AppendChild(&html.Node{
+			Type: html.TextNode,
+			Data: cssText,
+		})
+	}
+	return insertIntoHead(inputHTML, style)
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch_test
+
+import (
+	"testing"
+
+	"github.com/koonix/go-livereload/htmlpatch"
+	"golang.org/x/net/html"
+)
+
+func TestInsertStylesheet(t *testing.T) {
+	tests := []struct {
+		name       string
+		attrs      []html.Attribute
+		inputHTML  string
+		outputHTML string
+	}{
+		{
+			"blank",
+			nil,
+			``,
+			`<!DOCTYPE html><html><head><link rel="stylesheet" href="/dev.css"/></head><body></body></html>`,
+		},
+		{
+			"attrs",
+			[]html.Attribute{{Key: "media", Val: "screen"}},
+			`<html><head><title>t</title></head><body>lmao</body></html>`,
+			`<!DOCTYPE html><html><head><title>t</title><link rel="stylesheet" href="/dev.css" media="screen"/></head><body>lmao</body></html>`,
+		},
+		{
+			"conditional-comment",
+			nil,
+			`<!DOCTYPE html><html><head><!--[if IE]><link href=ie.css><![endif]--></head><body><![if !IE]><p>x</p><![endif]></body></html>`,
+			`<!DOCTYPE html><html><head><!--[if IE]><link href=ie.css><![endif]--><link rel="stylesheet" href="/dev.css"/></head><body><![if !IE]><p>x</p><![endif]></body></html>`,
+		},
+		{
+			"template-comment",
+			nil,
+			`<html><body><!-- ko if: a < b && c --><p>x</p><!-- /ko --></body></html>`,
+			`<html><head><link rel="stylesheet" href="/dev.css"/><body><!-- ko if: a < b && c --><p>x</p><!-- /ko --></body></html>`,
+		},
+		{
+			"template",
+			nil,
+			`<html><head><template id=t><style>:host{}</style><slot></slot></template></head><body><table><template><tr><td>1</td></tr></template></table></body></html>`,
+			`<html><head><template id=t><style>:host{}</style><slot></slot></template><link rel="stylesheet" href="/dev.css"/></head><body><table><template><tr><td>1</td></tr></template></table></body></html>`,
+		},
+		{
+			"custom-elements",
+			nil,
+			`<!DOCTYPE html><html><head></head><body><my-app/><table><my-row :key="id"></my-row></table></body></html>`,
+			`<!DOCTYPE html><html><head><link rel="stylesheet" href="/dev.css"/></head><body><my-app/><table><my-row :key="id"></my-row></table></body></html>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputHTML, err := htmlpatch.InsertStylesheet([]byte(test.inputHTML), test.attrs, "/dev.css")
+			if err != nil {
+				t.Fatalf("could not insert stylesheet into HTML: %s", err)
+			}
+			want := test.outputHTML
+			got := string(outputHTML)
+			if want != got {
+				t.Errorf("incorrect output html; want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestInsertStyle(t *testing.T) {
+	tests := []struct {
+		name       string
+		cssText    string
+		inputHTML  string
+		outputHTML string
+	}{
+		{
+			"blank",
+			`body { color: red; }`,
+			``,
+			`<!DOCTYPE html><html><head><style>body { color: red; }</style></head><body></body></html>`,
+		},
+		{
+			"full",
+			`p > a { color: red; }`,
+			`<!DOCTYPE html><html><head><meta key="value"/></head><body>lmao</body></html>`,
+			`<!DOCTYPE html><html><head><meta key="value"/><style>p > a { color: red; }</style></head><body>lmao</body></html>`,
+		},
+		{
+			"conditional-comment",
+			`p { color: red; }`,
+			`<!DOCTYPE html><html><head><!--[if IE]><link href=ie.css><![endif]--></head><body><![if !IE]><p>x</p><![endif]></body></html>`,
+			`<!DOCTYPE html><html><head><!--[if IE]><link href=ie.css><![endif]--><style>p { color: red; }</style></head><body><![if !IE]><p>x</p><![endif]></body></html>`,
+		},
+		{
+			"template-comment",
+			`p { color: red; }`,
+			`<html><body><!-- ko if: a < b && c --><p>x</p><!-- /ko --></body></html>`,
+			`<html><head><style>p { color: red; }</style><body><!-- ko if: a < b && c --><p>x</p><!-- /ko --></body></html>`,
+		},
+		{
+			"template",
+			`p { color: red; }`,
+			`<html><head><template id=t><style>:host{}</style><slot></slot></template></head><body></body></html>`,
+			`<html><head><template id=t><style>:host{}</style><slot></slot></template><style>p { color: red; }</style></head><body></body></html>`,
+		},
+		{
+			"custom-elements",
+			`p { color: red; }`,
+			`<!DOCTYPE html><html><head></head><body><my-app/><table><my-row :key="id"></my-row></table></body></html>`,
+			`<!DOCTYPE html><html><head><style>p { color: red; }</style></head><body><my-app/><table><my-row :key="id"></my-row></table></body></html>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputHTML, err := htmlpatch.InsertStyle([]byte(test.inputHTML), nil, test.cssText)
+			if err != nil {
+				t.Fatalf("could not insert style into HTML: %s", err)
+			}
+			want := test.outputHTML
+			got := string(outputHTML)
+			if want != got {
+				t.Errorf("incorrect output html; want %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Selector matches elements by tag name and attribute.
+// The zero Selector matches every element.
+type Selector struct {
+	// Tag is the tag name of the matched elements, such as "script".
+	// Empty matches any tag.
+	Tag string
+
+	// Attr is the name of an attribute the matched elements must have,
+	// such as "src". Empty matches regardless of attributes.
+	Attr string
+
+	// Value is a substring the value of the Attr attribute must contain,
+	// such as "googletagmanager.com". Empty matches any value.
+	Value string
+}
+
+// Matches reports whether node is an element matched by s.
+func (s Selector) Matches(node *html.Node) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+	if s.Tag != "" && !strings.EqualFold(node.Data, s.Tag) {
+		return false
+	}
+	if s.Attr == "" {
+		return true
+	}
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, s.Attr) && strings.Contains(attr.Val, s.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindAll returns the elements under node matched by sel, in document order.
+func FindAll(node *html.Node, sel Selector) []*html.Node {
+	var found []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if sel.Matches(n) {
+			found = append(found, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return found
+}
+
+// RemoveNodes returns a copy of inputHTML
+// with the elements matched by sel removed, along with their contents.
+func RemoveNodes(inputHTML []byte, sel Selector) (outputHTML []byte, err error) {
+	return patch(inputHTML, func(doc *html.Node) error {
+		for _, node := range FindAll(doc, sel) {
+			node.Parent.RemoveChild(node)
+		}
+		return nil
+	})
+}
+
+// ReplaceNodes returns a copy of inputHTML
+// with the elements matched by sel replaced by replacementHTML.
+func ReplaceNodes(
+	inputHTML []byte,
+	sel Selector,
+	replacementHTML string,
+) (
+	outputHTML []byte,
+	err error,
+) {
+	return patch(inputHTML, func(doc *html.Node) error {
+		for _, node := range FindAll(doc, sel) {
+			// Parse the replacement in the context of the parent,
+			// so that elements like table rows are parsed correctly.
+			context := node.Parent
+			if context.Type != html.ElementNode {
+				context = &html.Node{Type: html.ElementNode, Data: "body"}
+			}
+			nodes, err := html.ParseFragment(strings.NewReader(replacementHTML), context)
+			if err != nil {
+				return fmt.Errorf("could not parse replacement HTML: %w", err)
+			}
+			for _, n := range nodes {
+				node.Parent.InsertBefore(n, node)
+			}
+			node.Parent.RemoveChild(node)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch_test
+
+import (
+	"testing"
+
+	"github.com/koonix/go-livereload/htmlpatch"
+)
+
+func TestRemoveNodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		sel        htmlpatch.Selector
+		inputHTML  string
+		outputHTML string
+	}{
+		{
+			"tag",
+			htmlpatch.Selector{Tag: "script"},
+			`<head><script>a</script></head><body><p>text</p><script>b</script></body>`,
+			`<html><head></head><body><p>text</p></body></html>`,
+		},
+		{
+			"attr-value",
+			htmlpatch.Selector{Tag: "script", Attr: "src", Value: "analytics"},
+			`<head><script src="https://analytics.example.com/a.js"></script><script src="/app.js"></script></head>`,
+			`<html><head><script src="/app.js"></script></head><body></body></html>`,
+		},
+		{
+			"attr-presence",
+			htmlpatch.Selector{Attr: "data-track"},
+			`<p data-track="x">a</p><p>b</p>`,
+			`<html><head></head><body><p>b</p></body></html>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputHTML, err := htmlpatch.RemoveNodes([]byte(test.inputHTML), test.sel)
+			if err != nil {
+				t.Fatalf("could not remove nodes: %s", err)
+			}
+			want := test.outputHTML
+			got := string(outputHTML)
+			if want != got {
+				t.Errorf("incorrect output html; want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestReplaceNodes(t *testing.T) {
+	outputHTML, err := htmlpatch.ReplaceNodes(
+		[]byte(`<head><script src="/config.prod.js"></script></head><body><table><tr id="a"></tr></table></body>`),
+		htmlpatch.Selector{Tag: "script", Attr: "src", Value: "config.prod.js"},
+		`<script src="/config.dev.js"></script>`,
+	)
+	if err != nil {
+		t.Fatalf("could not replace nodes: %s", err)
+	}
+	want := `<html><head><script src="/config.dev.js"></script></head><body><table><tbody><tr id="a"></tr></tbody></table></body></html>`
+	got := string(outputHTML)
+	if want != got {
+		t.Errorf("incorrect output html; want %q, got %q", want, got)
+	}
+
+	outputHTML, err = htmlpatch.ReplaceNodes(
+		[]byte(`<table><tr id="a"></tr></table>`),
+		htmlpatch.Selector{Tag: "tr", Attr: "id", Value: "a"},
+		`<tr id="b"><td>x</td></tr>`,
+	)
+	if err != nil {
+		t.Fatalf("could not replace nodes: %s", err)
+	}
+	want = `<html><head></head><body><table><tbody><tr id="b"><td>x</td></tr></tbody></table></body></html>`
+	got = string(outputHTML)
+	if want != got {
+		t.Errorf("incorrect output html; want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"bytes"
+)
+
+// scanHeadEnd is a fast path for [headEnd]
+// that scans doc without tokenizing it.
+//
+// It's a minimal state machine that follows the tokenizer closely enough
+// to never mistake a "</head>" or "<body>" inside a comment, a tag attribute,
+// or the contents of a script, style or title element for the real thing.
+// It gives up, returning false, on anything it doesn't handle,
+// like character references, scripts containing "<!--",
+// template elements, or input that ends in the middle of a tag.
+func scanHeadEnd(doc []byte) (offset int, ok bool) {
+
+	i := 0
+	for i < len(doc) {
+
+		c := doc[i]
+		if isSpace(c) {
+			i++
+			continue
+		}
+		if c != '<' {
+			if c == '&' || c == 0 {
+				return 0, false
+			}
+			// Text that isn't whitespace implicitly ends the head.
+			return i, true
+		}
+		if i+1 >= len(doc) {
+			return 0, false
+		}
+
+		switch c := doc[i+1]; {
+
+		case c == '!' && bytes.HasPrefix(doc[i+2:], []byte("--")):
+			end, ok := commentEnd(doc, i+4)
+			if !ok {
+				return 0, false
+			}
+			i = end
+
+		case c == '!' || c == '?':
+			// A doctype or a bogus comment.
+			end := bytes.IndexByte(doc[i+2:], '>')
+			if end < 0 {
+				return 0, false
+			}
+			i += 2 + end + 1
+
+		case c == '/':
+			name, end, ok := scanTag(doc, i+2)
+			if !ok {
+				return 0, false
+			}
+			switch name {
+			case "head", "body", "html", "br":
+				return i, true
+			}
+			i = end
+
+		case isLetter(c):
+			name, end, ok := scanTag(doc, i+1)
+			if !ok {
+				return 0, false
+			}
+			if name == "template" {
+				return 0, false
+			}
+			if !isHeadTag(name) {
+				return i, true
+			}
+			if isRawHeadTag(name) {
+				end, ok = rawTextEnd(doc, end, name)
+				if !ok {
+					return 0, false
+				}
+			}
+			i = end
+
+		default:
+			return 0, false
+		}
+	}
+
+	return len(doc), true
+}
+
+// commentEnd returns the offset just past the end of the comment
+// whose contents start at i, right after the opening "<!--".
+func commentEnd(doc []byte, i int) (end int, ok bool) {
+	dashes := 0
+	beginning := true
+	for ; i < len(doc); i++ {
+		switch doc[i] {
+		case '-':
+			dashes++
+			continue
+		case '>':
+			// This also ends comments like "<!-->" and "<!--->".
+			if dashes >= 2 || beginning {
+				return i + 1, true
+			}
+		case '!':
+			if dashes >= 2 && i+1 < len(doc) {
+				switch doc[i+1] {
+				case '>':
+					return i + 2, true
+				case '-':
+					i++
+					dashes = 1
+					beginning = false
+					continue
+				}
+			}
+		}
+		dashes = 0
+		beginning = false
+	}
+	return 0, false
+}
+
+// scanTag returns the lowercase name of the tag whose name starts at i,
+// and the offset just past its closing ">".
+func scanTag(doc []byte, i int) (name string, end int, ok bool) {
+
+	if i >= len(doc) || !isLetter(doc[i]) {
+		return "", 0, false
+	}
+	start := i
+	for i < len(doc) && !isSpace(doc[i]) && doc[i] != '/' && doc[i] != '>' {
+		i++
+	}
+	name = lowerASCII(doc[start:i])
+
+	// Skip the attributes, looking for a ">" outside of a quoted value.
+	for {
+		i = skipSpace(doc, i)
+		if i >= len(doc) {
+			return "", 0, false
+		}
+		switch doc[i] {
+		case '>':
+			return name, i + 1, true
+		case '/':
+			i++
+			continue
+		}
+
+		// The attribute name. An "=" at its start is part of it.
+		i++
+		for i < len(doc) && !isSpace(doc[i]) && doc[i] != '/' && doc[i] != '>' && doc[i] != '=' {
+			i++
+		}
+
+		i = skipSpace(doc, i)
+		if i >= len(doc) {
+			return "", 0, false
+		}
+		if doc[i] == '/' {
+			i++
+			continue
+		}
+		if doc[i] != '=' {
+			continue
+		}
+
+		// The attribute value.
+		i = skipSpace(doc, i+1)
+		if i >= len(doc) {
+			return "", 0, false
+		}
+		switch q := doc[i]; q {
+		case '>':
+		case '"', '\'':
+			end := bytes.IndexByte(doc[i+1:], q)
+			if end < 0 {
+				return "", 0, false
+			}
+			i += 1 + end + 1
+		default:
+			for i < len(doc) && !isSpace(doc[i]) && doc[i] != '>' {
+				i++
+			}
+		}
+	}
+}
+
+// rawTextEnd returns the offset just past the end tag
+// of the element named name whose text contents start at i.
+func rawTextEnd(doc []byte, i int, name string) (end int, ok bool) {
+	for {
+		j := bytes.Index(doc[i:], []byte("</"))
+		if j < 0 {
+			return 0, false
+		}
+		// Scripts containing "<!--" have escaping rules of their own.
+		if name == "script" && bytes.Contains(doc[i:i+j], []byte("<!--")) {
+			return 0, false
+		}
+		i += j
+		n := i + 2 + len(name)
+		if n < len(doc) &&
+			lowerASCII(doc[i+2:n]) == name &&
+			(isSpace(doc[n]) || doc[n] == '/' || doc[n] == '>') {
+			_, end, ok := scanTag(doc, i+2)
+			return end, ok
+		}
+		i += 2
+	}
+}
+
+// lowerASCII returns b as a string with its ASCII letters lowercased,
+// leaving the others as-is like the tokenizer does.
+func lowerASCII(b []byte) string {
+	s := []byte(string(b))
+	for i, c := range s {
+		if 'A' <= c && c <= 'Z' {
+			s[i] = c + 'a' - 'A'
+		}
+	}
+	return string(s)
+}
+
+func skipSpace(doc []byte, i int) int {
+	for i < len(doc) && isSpace(doc[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
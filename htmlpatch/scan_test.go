@@ -0,0 +1,130 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var headEndTests = []struct {
+	name string
+	doc  string
+	want string // doc with "|" at the offset
+	ok   bool
+}{
+	{"empty", ``, `|`, true},
+	{"head", `<html><head><meta></head><body>`, `<html><head><meta>|</head><body>`, true},
+	{"body", `<head><title>x</title><body>`, `<head><title>x</title>|<body>`, true},
+	{"text", `<meta>  text`, `<meta>  |text`, true},
+	{"element", `<!DOCTYPE html><link><p>`, `<!DOCTYPE html><link>|<p>`, true},
+	{"end-html", `<head></html>`, `<head>|</html>`, true},
+	{"comment", `<head><!-- </head> --></head>`, `<head><!-- </head> -->|</head>`, true},
+	{"comment-abrupt", `<!--><body>`, `<!-->|<body>`, true},
+	{"comment-bang", `<!-- --!><body>`, `<!-- --!>|<body>`, true},
+	{"conditional-comment", `<!--[if IE]><body><![endif]--><![if !IE]></head>`, `<!--[if IE]><body><![endif]--><![if !IE]>|</head>`, true},
+	{"script", `<script>"</head><body>"</script ></head>`, `<script>"</head><body>"</script >|</head>`, true},
+	{"style", `<STYLE>a{}</style x="</head>"><body>`, `<STYLE>a{}</style x="</head>">|<body>`, true},
+	{"title", `<title></titles></head></TITLE></head>`, `<title></titles></head></TITLE>|</head>`, true},
+	{"attribute", `<meta content="<body>" name='</head>'><body>`, `<meta content="<body>" name='</head>'>|<body>`, true},
+	{"attribute-unquoted", `<meta a=x"y b=">"><body>`, `<meta a=x"y b=">">|<body>`, true},
+	{"end-tag-ignored", `<head></p></head>`, `<head></p>|</head>`, true},
+	{"script-escaped", `<script><!--<script></script></head>--></script></head>`, ``, false},
+	{"template", `<template></head></template></head>`, ``, false},
+	{"template-nested", `<template><template></template></head><body></template></head>`, ``, false},
+	{"reference", `&#32;<body>`, ``, false},
+	{"unterminated-tag", `<head><meta`, ``, false},
+	{"unterminated-script", `<script></head>`, ``, false},
+}
+
+func TestScanHeadEnd(t *testing.T) {
+	for _, test := range headEndTests {
+		t.Run(test.name, func(t *testing.T) {
+			offset, ok := scanHeadEnd([]byte(test.doc))
+			if ok != test.ok {
+				t.Fatalf("incorrect ok; want %t, got %t", test.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			got := test.doc[:offset] + "|" + test.doc[offset:]
+			if got != test.want {
+				t.Errorf("incorrect offset; want %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+// FuzzScanHeadEnd checks that the fast path agrees with the tokenizer,
+// and that the parser puts elements inserted at its offset in the head.
+func FuzzScanHeadEnd(f *testing.F) {
+	for _, test := range headEndTests {
+		f.Add(test.doc)
+	}
+	f.Fuzz(func(t *testing.T, doc string) {
+		offset, ok := scanHeadEnd([]byte(doc))
+		if !ok {
+			return
+		}
+		if want := tokenizeHeadEnd([]byte(doc)); offset != want {
+			t.Fatalf("disagrees with the tokenizer on %q; want %d, got %d", doc, want, offset)
+		}
+		checkHeadEnd(t, doc, offset)
+	})
+}
+
+// TestTokenizeHeadEnd checks that the parser puts elements
+// inserted at the offset of the tokenizer in the head,
+// including for the documents the fast path gives up on.
+func TestTokenizeHeadEnd(t *testing.T) {
+	for _, test := range headEndTests {
+		// Elements can't be inserted into unterminated raw text.
+		if strings.HasPrefix(test.name, "unterminated") {
+			continue
+		}
+		t.Run(test.name, func(t *testing.T) {
+			checkHeadEnd(t, test.doc, tokenizeHeadEnd([]byte(test.doc)))
+		})
+	}
+	t.Run("template-nested-offset", func(t *testing.T) {
+		doc := `<template><template></template></head><body></template></head>`
+		want := `<template><template></template></head><body></template>|</head>`
+		offset := tokenizeHeadEnd([]byte(doc))
+		if got := doc[:offset] + "|" + doc[offset:]; got != want {
+			t.Errorf("incorrect offset; want %q, got %q", want, got)
+		}
+	})
+}
+
+// checkHeadEnd fails t unless the parser puts an element
+// inserted into doc at offset in the head.
+func checkHeadEnd(t *testing.T, doc string, offset int) {
+	t.Helper()
+	marked := doc[:offset] + `<script id="livereload-marker"></script>` + doc[offset:]
+	root, err := html.Parse(strings.NewReader(marked))
+	if err != nil {
+		t.Fatalf("could not parse %q: %s", marked, err)
+	}
+	marker := findMarker(root)
+	if marker == nil || marker.Parent == nil || marker.Parent.DataAtom != atom.Head {
+		t.Fatalf("parser doesn't put the inserted element in the head in %q", marked)
+	}
+}
+
+func findMarker(n *html.Node) *html.Node {
+	for _, attr := range n.Attr {
+		if attr.Key == "id" && attr.Val == "livereload-marker" {
+			return n
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if m := findMarker(c); m != nil {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/net/html"
+)
+
+// needsSplicing reports whether the parse and render cycle
+// might not preserve doc, so that it should be spliced into instead.
+//
+// That's the case for documents that might contain:
+//
+//   - Comments, including conditional comments like "<!--[if IE]>"
+//     and downlevel-revealed ones like "<![if !IE]>".
+//     Comment contents get escaped and some comments get rewritten,
+//     which breaks legacy pages and templating markers inside comments.
+//   - XML declarations and processing instructions like "<?xml ...?>",
+//     as in XHTML documents served as HTML,
+//     which the parser reads as comments and renders as "<!--?xml ...?-->".
+//   - Template elements and custom elements like "<my-element>".
+//     Component frameworks rely on markup the parser normalizes,
+//     like custom elements written as self-closing tags,
+//     or placed in tables and moved out of them.
+func needsSplicing(doc []byte) bool {
+	if bytes.Contains(doc, []byte("<!--")) || bytes.Contains(doc, []byte("<![")) || bytes.Contains(doc, []byte("<?")) {
+		return true
+	}
+	for i := 0; i < len(doc); i++ {
+		if doc[i] != '<' || i+1 >= len(doc) || !isLetter(doc[i+1]) {
+			continue
+		}
+		start := i + 1
+		end := start
+		for end < len(doc) && !isSpace(doc[end]) && doc[end] != '/' && doc[end] != '>' {
+			end++
+		}
+		name := doc[start:end]
+		if bytes.IndexByte(name, '-') >= 0 || lowerASCII(name) == "template" {
+			return true
+		}
+		i = end - 1
+	}
+	return false
+}
+
+// spliceNode returns a copy of inputHTML
+// with node inserted at the end of the head element,
+// leaving the rest of the document byte-for-byte identical.
+// Unlike [patch], missing elements are not added;
+// browsers create them implicitly.
+func spliceNode(inputHTML []byte, node *html.Node) (outputHTML []byte, err error) {
+
+	buf := new(bytes.Buffer)
+	err = html.Render(buf, node)
+	if err != nil {
+		return inputHTML, fmt.Errorf("error rendering HTML: %v", err)
+	}
+
+	return splice(inputHTML, headEnd(inputHTML), buf.Bytes()), nil
+}
+
+// addMissingStartTags returns a copy of doc with the start tags
+// of its missing html, head and body elements added where browsers create them,
+// leaving the rest of the document byte-for-byte identical,
+// so that spliced documents get the elements that [patch] would add.
+// Unlike with [patch], a missing doctype isn't added,
+// since it would switch the document out of quirks mode.
+func addMissingStartTags(doc []byte) []byte {
+
+	// Keep the byte order mark at the start.
+	bom := 0
+	if bytes.HasPrefix(doc, []byte("\xef\xbb\xbf")) {
+		bom = 3
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(doc[bom:]))
+	offset := bom
+	htmlStart, headStart := len(doc), len(doc)
+	var hasHTML, hasHead, hasBody bool
+
+	// The html element starts at its start tag,
+	// or else at the first content that isn't a doctype, comment or whitespace,
+	// and the head element at the first such content after the html start tag.
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := len(z.Raw())
+		content := -1
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "html":
+				hasHTML = true
+				htmlStart = min(htmlStart, offset)
+				offset += raw
+				continue
+			case "head":
+				hasHead = true
+			case "body", "frameset":
+				hasBody = true
+			}
+			content = offset
+		case html.EndTagToken:
+			content = offset
+		case html.TextToken:
+			text := bytes.TrimLeft(z.Raw(), " \t\n\f\r")
+			if len(text) > 0 {
+				content = offset + raw - len(text)
+			}
+		}
+
+		if content >= 0 {
+			htmlStart = min(htmlStart, content)
+			headStart = min(headStart, content)
+		}
+		offset += raw
+	}
+
+	// Splice the head start tag first,
+	// since the html start tag goes before it.
+	out := doc
+	if !hasHead {
+		out = splice(out, headStart, []byte("<head>"))
+	}
+	if !hasHTML {
+		out = splice(out, htmlStart, []byte("<html>"))
+	}
+	if !hasBody {
+		out = splice(out, bodyStart(out), []byte("<body>"))
+	}
+	return out
+}
+
+// splice returns a copy of doc with insert inserted at offset.
+func splice(doc []byte, offset int, insert []byte) []byte {
+	out := make([]byte, 0, len(doc)+len(insert))
+	out = append(out, doc[:offset]...)
+	out = append(out, insert...)
+	out = append(out, doc[offset:]...)
+	return out
+}
+
+// headEnd returns the offset in doc at which an element can be inserted
+// so that browsers parse it as the last child of the head element.
+//
+// That is before the head end tag,
+// or if there is none, before the first element or text
+// that can't be in the head and therefore implicitly ends it.
+func headEnd(doc []byte) int {
+	// The byte order mark would be taken for text that ends the head.
+	if rest, ok := bytes.CutPrefix(doc, []byte("\xef\xbb\xbf")); ok {
+		return len(doc) - len(rest) + headEnd(rest)
+	}
+	if offset, ok := scanHeadEnd(doc); ok {
+		return offset
+	}
+	return tokenizeHeadEnd(doc)
+}
+
+// tokenizeHeadEnd is [headEnd] using the tokenizer.
+func tokenizeHeadEnd(doc []byte) int {
+
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	offset := 0
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return offset
+		}
+		raw := len(z.Raw())
+
+		switch tt {
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "head", "body", "html", "br":
+				return offset
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			if !isHeadTag(string(name)) {
+				return offset
+			}
+			// The contents of these are returned as text,
+			// which doesn't end the head.
+			if isRawHeadTag(string(name)) {
+				offset += raw
+				offset += skipUntilEndTag(z, string(name))
+				continue
+			}
+		case html.TextToken:
+			// Leading whitespace stays in the head.
+			text := bytes.TrimLeft(z.Raw(), " \t\n\f\r")
+			if len(text) > 0 {
+				return offset + raw - len(text)
+			}
+		}
+
+		offset += raw
+	}
+}
+
+// bodyStart returns the offset in doc at which elements can be inserted
+// so that browsers parse them as the first children of the body element.
+//
+// That is after the body start tag, or if there is none,
+// where the head ends, explicitly or implicitly.
+func bodyStart(doc []byte) int {
+
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	offset := 0
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		offset += len(z.Raw())
+		if tt == html.StartTagToken {
+			name, _ := z.TagName()
+			if string(name) == "body" {
+				return offset
+			}
+		}
+	}
+
+	offset = headEnd(doc)
+	if name, end, ok := scanTag(doc, offset+2); ok &&
+		bytes.HasPrefix(doc[offset:], []byte("</")) && name == "head" {
+		return end
+	}
+	return offset
+}
+
+// bodyEnd returns the offset in doc at which elements can be inserted
+// so that browsers parse them as the last children of the body element.
+//
+// That is before the last body end tag, or if there is none,
+// before the last html end tag, or at the end of doc.
+func bodyEnd(doc []byte) int {
+
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	offset := 0
+	bodyEnd, htmlEnd := -1, -1
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt == html.EndTagToken {
+			switch name, _ := z.TagName(); string(name) {
+			case "body":
+				bodyEnd = offset
+			case "html":
+				htmlEnd = offset
+			}
+		}
+		offset += len(z.Raw())
+	}
+
+	switch {
+	case bodyEnd >= 0:
+		return bodyEnd
+	case htmlEnd >= 0:
+		return htmlEnd
+	}
+	return len(doc)
+}
+
+// skipUntilEndTag advances z past the end tag of the element named name,
+// and returns the number of bytes skipped.
+// Elements nested in it with the same name, such as templates, are skipped, too.
+func skipUntilEndTag(z *html.Tokenizer, name string) int {
+	skipped := 0
+	depth := 1
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return skipped
+		}
+		skipped += len(z.Raw())
+		switch tt {
+		case html.StartTagToken:
+			if n, _ := z.TagName(); string(n) == name {
+				depth++
+			}
+		case html.EndTagToken:
+			if n, _ := z.TagName(); string(n) == name {
+				depth--
+				if depth == 0 {
+					return skipped
+				}
+			}
+		}
+	}
+}
+
+// isHeadTag reports whether an element with the given tag name
+// can appear before or in the head element without implicitly ending it.
+func isHeadTag(name string) bool {
+	switch name {
+	case "html", "head", "base", "basefont", "bgsound", "link", "meta",
+		"title", "noscript", "noframes", "style", "script", "template":
+		return true
+	}
+	return false
+}
+
+// isRawHeadTag reports whether the contents of an element
+// with the given tag name that can appear in the head
+// are text or markup that doesn't end the head.
+func isRawHeadTag(name string) bool {
+	switch name {
+	case "title", "noscript", "noframes", "style", "script", "template":
+		return true
+	}
+	return false
+}
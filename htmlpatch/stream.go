@@ -0,0 +1,109 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// streamBufferLimit is how much of the beginning of a document [ScriptWriter] buffers
+// while the scanner can't tell where the head ends,
+// before it resorts to the tokenizer, which might be misled by a truncated document.
+const streamBufferLimit = 64 << 10
+
+// ScriptWriter is an [io.WriteCloser] that writes the HTML document written to it
+// to another writer as it's written, with a script tag inserted at the end of its head,
+// for documents that are streamed progressively.
+//
+// The beginning of the document is buffered until the end of the head is found.
+// Unlike [InsertScript], the document is never parsed and rendered;
+// the script tag is spliced in, and browsers create the missing elements implicitly.
+// XML documents, as reported by [IsXML], are written unmodified.
+type ScriptWriter struct {
+	w      io.Writer
+	script []byte
+	buf    []byte
+	err    error
+
+	// done reports whether the buffered beginning of the document has been written.
+	done bool
+}
+
+// NewScriptWriter returns a [ScriptWriter] that writes to w.
+func NewScriptWriter(w io.Writer, scriptAttrs []html.Attribute, scriptContent string) (*ScriptWriter, error) {
+	buf := new(bytes.Buffer)
+	err := html.Render(buf, scriptTag(scriptAttrs, scriptContent))
+	if err != nil {
+		return nil, fmt.Errorf("error rendering HTML: %v", err)
+	}
+	return &ScriptWriter{w: w, script: buf.Bytes()}, nil
+}
+
+func (s *ScriptWriter) Write(p []byte) (n int, err error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.done {
+		n, s.err = s.w.Write(p)
+		return n, s.err
+	}
+	s.buf = append(s.buf, p...)
+	offset, ok := scanHeadEnd(s.buf)
+	switch {
+	case ok && offset < len(s.buf):
+		s.insert(offset)
+	case !ok && len(s.buf) >= streamBufferLimit:
+		s.insert(tokenizeHeadEnd(s.buf))
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	return len(p), nil
+}
+
+// Flush writes the buffered beginning of the document
+// and flushes the underlying writer if it has a Flush method,
+// such as an [net/http.ResponseWriter].
+// If the document is cut short where the script can't be inserted,
+// such as in the middle of a tag, nothing is written until more of it is.
+// Scripts can be anywhere in the head, so the script is inserted
+// where the document is cut short otherwise.
+func (s *ScriptWriter) Flush() {
+	if !s.done {
+		offset, ok := scanHeadEnd(s.buf)
+		if !ok {
+			return
+		}
+		s.insert(offset)
+	}
+	if f, ok := s.w.(interface{ Flush() }); ok && s.err == nil {
+		f.Flush()
+	}
+}
+
+// Close writes the buffered beginning of the document, if any is left,
+// inserting the script at the end of its head.
+// It doesn't close the underlying writer.
+func (s *ScriptWriter) Close() error {
+	if !s.done && s.err == nil {
+		s.insert(headEnd(s.buf))
+	}
+	return s.err
+}
+
+// insert writes the buffered beginning of the document
+// with the script inserted at offset.
+func (s *ScriptWriter) insert(offset int) {
+	out := s.buf
+	if !IsXML(s.buf) {
+		out = splice(s.buf, offset, s.script)
+	}
+	s.done = true
+	s.buf = nil
+	_, s.err = s.w.Write(out)
+}
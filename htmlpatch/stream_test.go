@@ -0,0 +1,109 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScriptWriter(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "head-end",
+			chunks: []string{"<html><head><title>t</title></he", "ad><body>hello</body></html>"},
+			want:   "<html><head><title>t</title><script>s</script></head><body>hello</body></html>",
+		},
+		{
+			name:   "no-head",
+			chunks: []string{"<!DOCTYPE html>\n<", "p>hello</p>"},
+			want:   "<!DOCTYPE html>\n<script>s</script><p>hello</p>",
+		},
+		{
+			name:   "raw-text",
+			chunks: []string{"<head><script>if (a </", "head) {}</script></head>"},
+			want:   "<head><script>if (a </head) {}</script><script>s</script></head>",
+		},
+		{
+			name:   "unterminated",
+			chunks: []string{"<head><meta charset=utf-8>"},
+			want:   "<head><meta charset=utf-8><script>s</script>",
+		},
+		{
+			name:   "xml",
+			chunks: []string{`<svg xmlns="http://www.w3.org/2000/svg">`, "</svg>"},
+			want:   `<svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			w, err := NewScriptWriter(out, nil, "s")
+			if err != nil {
+				t.Fatalf("could not create writer: %s", err)
+			}
+			for _, chunk := range test.chunks {
+				if _, err := w.Write([]byte(chunk)); err != nil {
+					t.Fatalf("could not write: %s", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("could not close: %s", err)
+			}
+			if out.String() != test.want {
+				t.Errorf("incorrect output;\nwant %q\ngot  %q", test.want, out.String())
+			}
+		})
+	}
+}
+
+// flushRecorder records what's written to it by the time it's flushed.
+type flushRecorder struct {
+	bytes.Buffer
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.String())
+}
+
+func TestScriptWriterFlush(t *testing.T) {
+
+	out := new(flushRecorder)
+	w, err := NewScriptWriter(out, nil, "s")
+	if err != nil {
+		t.Fatalf("could not create writer: %s", err)
+	}
+
+	w.Write([]byte("<head><tit"))
+	w.Flush()
+	if len(out.flushed) != 0 {
+		t.Errorf("flushed in the middle of a tag: %q", out.flushed)
+	}
+
+	w.Write([]byte("le>t</title>"))
+	w.Flush()
+	w.Write([]byte("</head><body>"))
+	w.Flush()
+	w.Close()
+
+	want := []string{
+		"<head><title>t</title><script>s</script>",
+		"<head><title>t</title><script>s</script></head><body>",
+	}
+	if len(out.flushed) != len(want) {
+		t.Fatalf("incorrect flushes;\nwant %q\ngot  %q", want, out.flushed)
+	}
+	for i := range want {
+		if out.flushed[i] != want[i] {
+			t.Errorf("incorrect flush %d;\nwant %q\ngot  %q", i, want[i], out.flushed[i])
+		}
+	}
+}
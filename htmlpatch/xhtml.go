@@ -0,0 +1,77 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// InsertScriptXHTML returns a copy of the XHTML document inputXHTML
+// with a script tag inserted at the end of its head element,
+// or if it has none, at the end of its body element,
+// leaving the rest of the document byte-for-byte identical.
+//
+// Unlike [InsertScript], the document isn't parsed as HTML,
+// which would mangle it, and the script content
+// is wrapped in a CDATA section so that it's well-formed XML.
+func InsertScriptXHTML(
+	inputXHTML []byte,
+	scriptAttrs []html.Attribute,
+	scriptContent string,
+) (
+	outputXHTML []byte,
+	err error,
+) {
+
+	offset := xhtmlScriptOffset(inputXHTML)
+	if offset < 0 {
+		return inputXHTML, errors.New("XHTML document has no head or body element")
+	}
+
+	var b strings.Builder
+	b.WriteString("<script")
+	for _, attr := range scriptAttrs {
+		b.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	b.WriteString(">")
+	if scriptContent != "" {
+		// Split the CDATA section wherever the script contains its end marker.
+		content := strings.ReplaceAll(scriptContent, "]]>", "]]]]><![CDATA[>")
+		b.WriteString("//<![CDATA[\n" + content + "\n//]]>")
+	}
+	b.WriteString("</script>")
+
+	return splice(inputXHTML, offset, []byte(b.String())), nil
+}
+
+// xhtmlScriptOffset returns the offset of the end tag of the head element of doc,
+// or if it has none, of the last end tag of its body element, or -1.
+// The document is tokenized as XML, so that the end tags within
+// comments, CDATA sections and processing instructions aren't mistaken for them.
+func xhtmlScriptOffset(doc []byte) int {
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	bodyEnd := -1
+	for {
+		offset := int(d.InputOffset())
+		tok, err := d.RawToken()
+		if err != nil {
+			return bodyEnd
+		}
+		if end, ok := tok.(xml.EndElement); ok {
+			switch end.Name.Local {
+			case "head":
+				return offset
+			case "body":
+				bodyEnd = offset
+			}
+		}
+	}
+}
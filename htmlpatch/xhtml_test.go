@@ -0,0 +1,80 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/koonix/go-livereload/htmlpatch"
+	"golang.org/x/net/html"
+)
+
+func TestInsertScriptXHTML(t *testing.T) {
+	attrs := []html.Attribute{{Key: "nonce", Val: `a"b`}}
+	tests := []struct {
+		name    string
+		doc     string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "head",
+			doc:     `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>t</title></head><body/></html>`,
+			content: `if (a < b && c) {}`,
+			want:    `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>t</title><script nonce="a&#34;b">//<![CDATA[` + "\n" + `if (a < b && c) {}` + "\n" + `//]]></script></head><body/></html>`,
+		},
+		{
+			name:    "body",
+			doc:     `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>x</p></body></html>`,
+			content: `x = "]]>"`,
+			want:    `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>x</p><script nonce="a&#34;b">//<![CDATA[` + "\n" + `x = "]]]]><![CDATA[>"` + "\n" + `//]]></script></body></html>`,
+		},
+		{
+			name: "markup-in-comment",
+			doc:  `<html xmlns="http://www.w3.org/1999/xhtml"><!-- </head> --><head><?pi </head>?><style><![CDATA[ </head> ]]></style></head><body/></html>`,
+			want: `<html xmlns="http://www.w3.org/1999/xhtml"><!-- </head> --><head><?pi </head>?><style><![CDATA[ </head> ]]></style><script nonce="a&#34;b"></script></head><body/></html>`,
+		},
+		{
+			name: "body-end-in-comment",
+			doc:  `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>x</p></body><!-- </body> --></html>`,
+			want: `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>x</p><script nonce="a&#34;b"></script></body><!-- </body> --></html>`,
+		},
+		{
+			name:    "no-elements",
+			doc:     `<html xmlns="http://www.w3.org/1999/xhtml"/>`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := htmlpatch.InsertScriptXHTML([]byte(test.doc), attrs, test.content)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("incorrect result;\nwant %s\ngot  %s", test.want, got)
+			}
+			d := xml.NewDecoder(bytes.NewReader(got))
+			for {
+				_, err := d.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("result is not well-formed XML: %s", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch
+
+import (
+	"bytes"
+
+	"golang.org/x/net/html"
+)
+
+// IsXML reports whether doc appears to be an XML document,
+// such as a standalone SVG image or an Atom feed, rather than an HTML document.
+// That is the case if its root element is an "svg" or "math" element,
+// or if it starts with an XML declaration and its root element isn't "html".
+// XHTML documents that start with an XML declaration are therefore not XML,
+// since they're served as HTML as often as not.
+//
+// Such documents are mangled by the parse and render cycle
+// the other functions of this package use,
+// since the HTML parser turns the XML declaration into a comment
+// and wraps the document in html and body elements.
+func IsXML(doc []byte) bool {
+
+	doc = bytes.TrimPrefix(doc, []byte("\xef\xbb\xbf")) // Byte order mark.
+	doc = bytes.TrimSpace(doc)
+	declared := bytes.HasPrefix(doc, []byte("<?xml"))
+
+	// The tokenizer reads the XML declaration
+	// and processing instructions as comments.
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return declared
+		case html.CommentToken, html.DoctypeToken:
+			continue
+		case html.TextToken:
+			if len(bytes.TrimSpace(z.Text())) == 0 {
+				continue
+			}
+			return false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			if declared {
+				return string(name) != "html"
+			}
+			return string(name) == "svg" || string(name) == "math"
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package htmlpatch_test
+
+import (
+	"testing"
+
+	"github.com/koonix/go-livereload/htmlpatch"
+)
+
+func TestIsXML(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want bool
+	}{
+		{"blank", ``, false},
+		{"text", `mytext`, false},
+		{"html", `<!DOCTYPE html><html><body><svg></svg></body></html>`, false},
+		{"fragment", `<p>myparagraph</p><svg></svg>`, false},
+		{"xml-declaration", `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`, true},
+		{"bom", "\xef\xbb\xbf<?xml version=\"1.0\"?><feed></feed>", true},
+		{"svg", "\n<!-- icon -->\n<svg xmlns=\"http://www.w3.org/2000/svg\"><path d=\"M0\"/></svg>", true},
+		{"svg-doctype", `<!DOCTYPE svg><svg></svg>`, true},
+		{"math", `<math><mi>x</mi></math>`, true},
+		{"rss", "<?xml version=\"1.0\"?>\n<?xml-stylesheet href=\"feed.xsl\"?>\n<rss><channel></channel></rss>", true},
+		{"xhtml", `<?xml version="1.0"?><!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd"><html xmlns="http://www.w3.org/1999/xhtml"><head></head></html>`, false},
+		{"xhtml-uppercase", `<?xml version="1.0"?><HTML><head></head></HTML>`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := htmlpatch.IsXML([]byte(test.doc))
+			if got != test.want {
+				t.Errorf("incorrect result; want %t, got %t", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fswatch provides detection of file changes by polling,
+// which behaves the same on every platform and filesystem,
+// including network and container filesystems that don't report changes.
+//
+// Every poll walks the watched directories and stats their files,
+// so its cost grows with the number of files in them;
+// directories such as "node_modules" should be skipped using the match function.
+package fswatch
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Watch polls the files under roots every interval
+// and calls fn with the paths of the files that were
+// created, modified or removed since the previous poll.
+//
+// Files for which match returns false are ignored,
+// and directories for which it returns false are skipped
+// without being walked; dir reports which one path is.
+// Directories whose names start with a dot (such as ".git") are skipped.
+//
+// Watch blocks until ctx is done.
+func Watch(
+	ctx context.Context,
+	interval time.Duration,
+	roots []string,
+	match func(path string, dir bool) bool,
+	fn func(changed []string),
+) {
+	prev := snapshot(roots, match)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			cur := snapshot(roots, match)
+			changed := diff(prev, cur)
+			prev = cur
+			if len(changed) > 0 {
+				fn(changed)
+			}
+		}
+	}
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func snapshot(roots []string, match func(path string, dir bool) bool) map[string]stamp {
+	files := make(map[string]stamp)
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// The file might have been removed while walking.
+				return nil
+			}
+			if d.IsDir() {
+				if path == root {
+					return nil
+				}
+				if strings.HasPrefix(d.Name(), ".") || (match != nil && !match(path, true)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if match != nil && !match(path, false) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			files[path] = stamp{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+func diff(prev, cur map[string]stamp) (changed []string) {
+	for path, s := range cur {
+		p, ok := prev[path]
+		if !ok || !p.modTime.Equal(s.modTime) || p.size != s.size {
+			changed = append(changed, path)
+		}
+	}
+	for path := range prev {
+		if _, ok := cur[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
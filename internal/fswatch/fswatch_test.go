@@ -0,0 +1,68 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package fswatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+
+	write("a.go", "package a")
+	os.Mkdir(filepath.Join(dir, ".git"), 0o755)
+	os.Mkdir(filepath.Join(dir, "node_modules"), 0o755)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan []string, 10)
+	var walkedSkipped atomic.Bool
+	match := func(path string, dir bool) bool {
+		if strings.Contains(path, "node_modules") {
+			if !dir {
+				walkedSkipped.Store(true)
+			}
+			return false
+		}
+		return dir || strings.HasSuffix(path, ".go")
+	}
+	go Watch(ctx, 10*time.Millisecond, []string{dir}, match, func(changed []string) {
+		changes <- changed
+	})
+
+	// Give the first snapshot a chance to be taken.
+	time.Sleep(50 * time.Millisecond)
+
+	write("b.go", "package b")
+	write("c.txt", "ignored")
+	write(filepath.Join(".git", "d.go"), "ignored")
+	write(filepath.Join("node_modules", "e.go"), "ignored")
+
+	select {
+	case changed := <-changes:
+		want := filepath.Join(dir, "b.go")
+		if len(changed) != 1 || changed[0] != want {
+			t.Errorf("incorrect changed files; want [%s], got %v", want, changed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change not detected")
+	}
+	if walkedSkipped.Load() {
+		t.Errorf("walked a skipped directory")
+	}
+}
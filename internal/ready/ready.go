@@ -0,0 +1,96 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ready provides functionality for waiting
+// until a server is ready to serve requests.
+package ready
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// WaitTCP blocks until a TCP connection to addr can be established,
+// retrying every interval.
+// It returns ctx.Err() if ctx is done before that.
+func WaitTCP(ctx context.Context, addr string, interval time.Duration) error {
+	d := &net.Dialer{Timeout: interval}
+	for {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// WatchRestarts calls fn whenever the server at addr
+// stops accepting TCP connections and then starts accepting them again,
+// which indicates that it has been restarted.
+// fn is also called if the server isn't up initially and later comes up.
+//
+// A connection to the server is kept open while it's up,
+// and it's redialed right after it's dropped.
+// A restart is therefore missed if the server is accepting connections again
+// by the time of the redial, since that's indistinguishable
+// from the server closing an idle connection.
+//
+// WatchRestarts blocks until ctx is done.
+func WatchRestarts(ctx context.Context, addr string, interval time.Duration, fn func()) {
+	d := &net.Dialer{Timeout: interval}
+	down := false
+	for ctx.Err() == nil {
+
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			down = true
+			sleep(ctx, interval)
+			continue
+		}
+
+		if down {
+			down = false
+			fn()
+		}
+
+		// Servers may close idle connections on their own;
+		// avoid redialing in a tight loop if they do so immediately.
+		start := time.Now()
+		waitClosed(ctx, conn)
+		if time.Since(start) < interval {
+			sleep(ctx, interval)
+		}
+	}
+}
+
+// waitClosed blocks until conn is closed by the remote end or ctx is done,
+// and closes conn.
+func waitClosed(ctx context.Context, conn net.Conn) {
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+	defer conn.Close()
+	b := make([]byte, 1)
+	for {
+		_, err := conn.Read(b)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
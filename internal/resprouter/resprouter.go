@@ -7,8 +7,10 @@
 package resprouter
 
 import (
+	"bufio"
 	"bytes"
 	"io"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -115,6 +117,40 @@ func (r *Router) WriteHeader(statusCode int) {
 	}}
 }
 
+// Flush flushes the writer the response is routed to,
+// if it's an [http.Flusher].
+// Responses that are being sniffed aren't flushed.
+func (r *Router) Flush() {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection of the writer the response is routed to,
+// if it's an [http.Hijacker].
+func (r *Router) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.writer.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap returns the writer the response is routed to,
+// if it's an [http.ResponseWriter], for [http.ResponseController].
+func (r *Router) Unwrap() http.ResponseWriter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, _ := r.writer.(http.ResponseWriter)
+	return w
+}
+
 // ==========
 
 type writer struct {
@@ -6,67 +6,209 @@ package retrier
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 )
 
+// Policy specifies when and how requests are retried.
+type Policy struct {
+	// MaxElapsed is how long to keep retrying a request for.
+	// Zero disables retrying.
+	MaxElapsed time.Duration
+
+	// InitialDelay is the delay before the first retry,
+	// which doubles with every retry up to MaxDelay.
+	// Each delay is randomized to between half of it and all of it,
+	// so that concurrent requests don't retry in lockstep.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+
+	// RetryStatus are the response status codes that are retried,
+	// such as 503 Service Unavailable.
+	// The delay specified by the Retry-After header of the response
+	// is used if it's present and within MaxElapsed.
+	RetryStatus []int
+
+	// MaxBodySize is the largest request body that's buffered for retrying,
+	// for requests that can't recreate their body using [http.Request.GetBody].
+	// Requests with larger bodies are not retried.
+	MaxBodySize int64
+}
+
 // Transport is an [http.RoundTripper]
-// that retries the request several times until it succeeds.
+// that retries the requests that fail, as specified by its [Policy].
+//
+// Requests that failed to connect are always safe to retry,
+// since they didn't reach the server.
+// Requests that may have reached the server, or got a response to retry,
+// are only retried if they're idempotent,
+// as reported by [isIdempotent].
 type Transport struct {
-	retryDelay    time.Duration
-	maxRetryCount int
+	transport http.RoundTripper
+	policy    Policy
 }
 
-// New creates a new [Transport].
-func New(retryDelay, maxRetryTime time.Duration) *Transport {
+// New creates a new [Transport]
+// that makes the requests using the given transport.
+func New(transport http.RoundTripper, policy Policy) *Transport {
+	if policy.InitialDelay <= 0 {
+		policy.InitialDelay = 100 * time.Millisecond
+	}
+	if policy.MaxDelay < policy.InitialDelay {
+		policy.MaxDelay = policy.InitialDelay
+	}
 	return &Transport{
-		retryDelay:    retryDelay,
-		maxRetryCount: int(maxRetryTime / retryDelay),
+		transport: transport,
+		policy:    policy,
 	}
 }
 
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 
-	// br represents the request body as a [*bytes.Reader] which is seekable.
-	var br *bytes.Reader
+	if t.policy.MaxElapsed <= 0 {
+		return t.transport.RoundTrip(req)
+	}
 
-	// Read req.Body into br.
-	if req.Body != nil && req.Body != http.NoBody {
-		b, err := io.ReadAll(req.Body)
-		if err != nil {
-			return nil, fmt.Errorf("could not read request body: %w", err)
-		}
-		br = bytes.NewReader(b)
+	getBody, err := t.bodyGetter(req)
+	if err != nil {
+		return nil, err
+	}
+	if getBody == nil {
+		return t.transport.RoundTrip(req)
 	}
 
-	origReq := req
-	var roundtripErr error
+	start := time.Now()
+	delay := t.policy.InitialDelay
+	for attempt := 0; ; attempt++ {
 
-	for range t.maxRetryCount {
+		// Clone the request, renewing its body.
+		r := req.Clone(req.Context())
+		if attempt > 0 || req.GetBody == nil {
+			r.Body, err = getBody()
+			if err != nil {
+				return nil, fmt.Errorf("could not renew request body: %w", err)
+			}
+		}
 
-		// Clone the request.
-		req := origReq.Clone(origReq.Context())
+		resp, err := t.transport.RoundTrip(r)
+		wait, retry := t.shouldRetry(req, resp, err, delay)
+		if !retry || time.Since(start)+wait > t.policy.MaxElapsed {
+			return resp, err
+		}
+		if resp != nil {
+			io.CopyN(io.Discard, resp.Body, 4<<10)
+			resp.Body.Close()
+		}
 
-		// Renew the request body.
-		if br != nil {
-			br.Seek(0, io.SeekStart)
-			req.Body = io.NopCloser(br)
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			if err == nil {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+			return nil, fmt.Errorf("%w (retrying after: %w)", req.Context().Err(), err)
+		case <-timer.C:
 		}
+		delay = min(delay*2, t.policy.MaxDelay)
+	}
+}
+
+// bodyGetter returns a function that returns a new copy of the body of req,
+// buffering it if needed, or nil if the request can't be retried
+// since its body is too large.
+func (t *Transport) bodyGetter(req *http.Request) (func() (io.ReadCloser, error), error) {
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return func() (io.ReadCloser, error) { return http.NoBody, nil }, nil
+	}
+	if req.GetBody != nil {
+		return req.GetBody, nil
+	}
+
+	// Buffer the body, unless it's larger than the limit,
+	// in which case it's sent as-is without retrying.
+	b, err := io.ReadAll(io.LimitReader(req.Body, t.policy.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read request body: %w", err)
+	}
+	if int64(len(b)) > t.policy.MaxBodySize {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), req.Body), req.Body}
+		return nil, nil
+	}
+	req.Body.Close()
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}, nil
+}
 
-		// Make the request and get a response.
-		resp, err := http.DefaultTransport.RoundTrip(req)
+// shouldRetry reports whether to retry req given its outcome,
+// and how long to wait before doing so.
+func (t *Transport) shouldRetry(req *http.Request, resp *http.Response, err error, delay time.Duration) (wait time.Duration, retry bool) {
 
-		// Retry if request failed.
-		if err != nil {
-			roundtripErr = err
-			time.Sleep(t.retryDelay)
-			continue
+	// Randomize the delay to between half of it and all of it.
+	wait = delay/2 + rand.N(delay/2+1)
+
+	if err != nil {
+		if req.Context().Err() != nil {
+			return 0, false
 		}
+		return wait, isDialError(err) || isIdempotent(req)
+	}
+
+	if !slices.Contains(t.policy.RetryStatus, resp.StatusCode) || !isIdempotent(req) {
+		return 0, false
+	}
+	if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+		wait = after
+	}
+	return wait, true
+}
 
-		return resp, nil
+// isDialError reports whether err is from failing to connect to the server,
+// such as while it's restarting, in which case the request didn't reach it.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isIdempotent reports whether req can be safely sent more than once,
+// like [http.Transport] does: if its method is idempotent,
+// or it has an "Idempotency-Key" or "X-Idempotency-Key" header.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
 	}
+	return ok
+}
 
-	return nil, roundtripErr
+// retryAfter parses the value of a Retry-After header,
+// which is either a number of seconds or a date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
 }
@@ -0,0 +1,165 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package retrier
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	policy := Policy{
+		MaxElapsed:   time.Second,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     4 * time.Millisecond,
+		RetryStatus:  []int{http.StatusServiceUnavailable},
+		MaxBodySize:  16,
+	}
+	dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Err: errors.New("connection reset")}
+
+	// respond returns a transport that gives the given outcomes in order,
+	// repeating the last one, and records the bodies of the requests.
+	respond := func(bodies *[]string, outcomes ...any) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			b, _ := io.ReadAll(req.Body)
+			*bodies = append(*bodies, string(b))
+			o := outcomes[min(len(*bodies), len(outcomes))-1]
+			if err, ok := o.(error); ok {
+				return nil, err
+			}
+			resp := &http.Response{
+				StatusCode: o.(int),
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader("")),
+			}
+			if resp.StatusCode == http.StatusServiceUnavailable {
+				resp.Header.Set("Retry-After", "0")
+			}
+			return resp, nil
+		})
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		header   http.Header
+		outcomes []any
+		attempts int
+		status   int
+	}{
+		{"dial-error", "GET", "", nil, []any{dialErr, dialErr, 200}, 3, 200},
+		{"dial-error-post", "POST", "data", nil, []any{dialErr, 200}, 2, 200},
+		{"read-error-get", "GET", "", nil, []any{readErr, 200}, 2, 200},
+		{"read-error-post", "POST", "data", nil, []any{readErr, 200}, 1, 0},
+		{"read-error-idempotency-key", "POST", "data", http.Header{"Idempotency-Key": {"1"}}, []any{readErr, 200}, 2, 200},
+		{"status", "GET", "", nil, []any{503, 503, 200}, 3, 200},
+		{"status-post", "POST", "data", nil, []any{503, 200}, 1, 503},
+		{"status-not-retried", "GET", "", nil, []any{500, 200}, 1, 500},
+		{"large-body", "PUT", "more than sixteen bytes", nil, []any{dialErr, 200}, 1, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var bodies []string
+			tr := New(respond(&bodies, test.outcomes...), policy)
+			var body io.Reader
+			if test.body != "" {
+				// Hide the type of the reader from NewRequest,
+				// so that it doesn't set GetBody.
+				body = io.MultiReader(strings.NewReader(test.body))
+			}
+			req, _ := http.NewRequest(test.method, "http://example.com", body)
+			for k, v := range test.header {
+				req.Header[k] = v
+			}
+			resp, err := tr.RoundTrip(req)
+			if len(bodies) != test.attempts {
+				t.Errorf("got %d attempts, want %d", len(bodies), test.attempts)
+			}
+			for i, b := range bodies {
+				if b != test.body {
+					t.Errorf("attempt %d: got body %q, want %q", i, b, test.body)
+				}
+			}
+			switch {
+			case test.status == 0 && err == nil:
+				t.Errorf("got status %d, want error", resp.StatusCode)
+			case test.status != 0 && err != nil:
+				t.Errorf("got error %q, want status %d", err, test.status)
+			case test.status != 0 && resp.StatusCode != test.status:
+				t.Errorf("got status %d, want %d", resp.StatusCode, test.status)
+			}
+		})
+	}
+
+	t.Run("context", func(t *testing.T) {
+		var bodies []string
+		p := policy
+		p.InitialDelay = time.Minute
+		p.MaxDelay = time.Minute
+		p.MaxElapsed = time.Hour
+		tr := New(respond(&bodies, dialErr), p)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com", nil)
+		start := time.Now()
+		_, err := tr.RoundTrip(req)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("returned after %s, want it to return once the context is done", d)
+		}
+	})
+
+	t.Run("max-elapsed", func(t *testing.T) {
+		var bodies []string
+		p := policy
+		p.MaxElapsed = 20 * time.Millisecond
+		tr := New(respond(&bodies, dialErr), p)
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		_, err := tr.RoundTrip(req)
+		if !errors.Is(err, dialErr) {
+			t.Errorf("got error %v, want %v", err, dialErr)
+		}
+		if len(bodies) < 2 {
+			t.Errorf("got %d attempts, want more than one", len(bodies))
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+	}
+	for _, test := range tests {
+		got, ok := retryAfter(test.value)
+		if got != test.want || ok != test.ok {
+			t.Errorf("retryAfter(%q) = %s, %t; want %s, %t", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -4,9 +4,10 @@
 // Package livereload provides remote webpage reloading functionality,
 // by injecting a script into HTML responses that listens to [Server-Sent Events].
 //
-// Serve a directory:
+// Serve a directory, reloading the webpages when its files change:
 //
-//	lr := livereload.New(http.FileServer(http.Dir("frontend")))
+//	lr := livereload.New(livereload.FileServer(http.Dir("frontend")))
+//	go livereload.Watch(ctx, lr, "frontend")
 //	http.ListenAndServe(":8090", lr)
 //
 // Proxy another webserver:
@@ -24,30 +25,104 @@ package livereload
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"mime"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"net/netip"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
-	"text/template"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/koonix/go-livereload/internal/htmlpatch"
+	"github.com/koonix/go-livereload/htmlpatch"
 	"github.com/koonix/go-livereload/internal/resprouter"
-	"github.com/koonix/go-livereload/internal/retrier"
-	"github.com/koonix/go-livereload/internal/sse"
+	"github.com/koonix/go-livereload/sse"
 	"golang.org/x/net/html"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/websocket"
+	"golang.org/x/text/encoding"
 )
 
 // Handler is returned by [New].
 type Handler struct {
-	upstream       http.Handler
-	eventPath      string
-	disableCaching bool
-	sseHandler     *sse.Handler
-	script         string
+	upstream           http.Handler
+	enabled            bool
+	eventPath          string
+	eventURL           string
+	basePath           string
+	corsOrigins        []string
+	credentials        bool
+	transport          Transport
+	csrfProtection     bool
+	trustedOrigins     []string
+	triggerToken       string
+	allowedClients     []netip.Prefix
+	requestRewrite     func(req *http.Request)
+	responseHeader     func(header http.Header)
+	onInject           func(req *http.Request, stats InjectStats)
+	onClientConnect    func(req *http.Request)
+	onClientDisconnect func(req *http.Request)
+	onReload           func(ev sse.Event)
+	logger             *slog.Logger
+	stats              stats
+	scriptNonce        func(req *http.Request, header http.Header) string
+	scriptPath         string
+	scriptETag         string
+	htmlTransforms     []func(html []byte) ([]byte, error)
+	injectFilter       func(req *http.Request) bool
+	streaming          bool
+	preserveMarkup     bool
+	skipPaths          []string
+	baseHref           string
+	noscriptRefresh    time.Duration
+	snippets           []snippet
+	upstreamTimeout    time.Duration
+	disableCaching     bool
+	assetCacheControl  string
+	restartDetection   bool
+	ghostMode          bool
+	toolbar            bool
+	reloadKinds        map[string]ReloadKind
+	reloadDebounce     time.Duration
+	debouncer          reloadDebouncer
+	sseOptions         []sse.Option
+	sseHandler         *sse.Handler
+	script             string
+
+	// restarts watches the upstream for restarts
+	// while there are webpages listening for events.
+	restarts     restartWatcher
+	mu           sync.Mutex
+	listeners    int
+	stopRestarts context.CancelFunc
+
+	// collisionWarning is set if the upstream serves the event path.
+	collisionOnce    sync.Once
+	collisionWarning atomic.Pointer[string]
+
+	// closed is set by [Handler.Close].
+	closed atomic.Bool
+
+	// buildError is the error set by [Handler.ReloadError],
+	// shown to the webpages that connect while it's set.
+	buildError atomic.Pointer[string]
+
+	// bootID identifies the Handler, so that webpages can tell
+	// when they reconnect to a new one, such as after the process restarts.
+	bootID string
 }
 
 // New creates a [Handler].
@@ -55,43 +130,145 @@ type Handler struct {
 // Handler proxies the given upstream handler
 // to inject an event listener script into the HTML responses.
 // Necessary HTML elements are added if missing.
+// Documents in other character encodings, as declared by their Content-Type
+// or meta charset element, are transcoded to UTF-8 for injecting the script,
+// and back. XHTML documents served as "application/xhtml+xml"
+// have the script inserted as XML, without the other modifications.
 //
 // The event listener script reloads the webpage
 // upon receiving reload messages,
 // which can be sent using [Handler.Reload],
 // or by making a POST request to the event path,
 // which is "/livereloadevents" by default.
+// POST requests made by webpages of other origins are rejected;
+// see [WithCSRFProtection] for details.
 //
 // The default event path can be changed using the [WithEventPath] option.
+// If the upstream also serves the event path, a warning is logged
+// and shown in the browser console of the webpages.
+//
+// Events are numbered, and the recent ones can be polled for
+// by making a GET request to the event path with the query "?since=<seq>",
+// which responds with the events published after the numbered one as JSON:
+//
+//	{"seq": 3, "complete": true, "boot": "9f2c…", "events": [{"seq": 3, "type": "message", "data": "reload"}]}
+//
+// "seq" is the number of the last published event, to poll with next time.
+// "complete" is false if some of the events after the numbered one are no longer kept.
+// "boot" is the boot ID of the Handler, described below.
+// Webpages use it to catch up on the events missed while disconnected,
+// such as while the computer was asleep.
+//
+// Each Handler has a random boot ID, which is included in the injected script
+// and sent to the webpages as a "boot" event when they connect.
+// Webpages reload when they reconnect and get a different boot ID
+// than the one they were loaded with, such as after the process has restarted,
+// since they may be stale and the new Handler doesn't know the events they missed.
 //
 // The header "Cache-Control: no-store"
 // is included in the responses, to keep browsers from caching them
 // and have them reacquire all resources on each reload.
-// Use the [WithDisableCaching] option to control this behavior.
+// Use the [WithDisableCaching] option to control this behavior,
+// and the [WithAssetCacheControl] option to let browsers cache the responses
+// that the script isn't injected into.
+//
+// If the upstream is created by [ReverseProxy],
+// the webpages are also reloaded when the upstream appears to have restarted.
+// Use the [WithRestartDetection] option to control this behavior.
 func New(upstream http.Handler, options ...Option) *Handler {
 	h := &Handler{
-		upstream:       upstream,
-		eventPath:      "/livereloadevents",
-		disableCaching: true,
-		sseHandler:     sse.New(),
+		upstream:          upstream,
+		enabled:           true,
+		eventPath:         "/livereloadevents",
+		csrfProtection:    true,
+		disableCaching:    true,
+		assetCacheControl: "no-store",
+		restartDetection:  true,
+		reloadKinds:       defaultReloadKinds(),
+		scriptNonce:       headerScriptNonce,
+		logger:            slog.Default(),
+		bootID:            randomHex(8),
 	}
 	for _, fn := range options {
 		fn(h)
 	}
-	h.script = createScript(h.eventPath)
+	if h.credentials && !slices.ContainsFunc(h.corsOrigins, func(o string) bool { return o != "*" }) {
+		h.logger.Warn("livereload: credentials are enabled but no origin is allowed to send them; use the livereload.WithCORSOrigins option to list the origins of the webpages")
+	}
+	h.sseHandler = sse.New(h.sseOptions...)
+	if rw, ok := upstream.(restartWatcher); ok && h.restartDetection {
+		h.restarts = rw
+	}
+	if h.eventURL == "" {
+		h.eventURL = h.basePath + h.eventPath
+	}
+	config := scriptConfig{
+		URL:         h.eventURL,
+		Credentials: h.credentials,
+		Token:       h.triggerToken,
+		Toolbar:     h.toolbar,
+		Boot:        h.bootID,
+	}
+	if h.transport == TransportWebSocket {
+		config.Transport = "websocket"
+	}
+	if h.ghostMode {
+		config.GhostURL = h.eventURL + "/ghost"
+	}
+	h.script = createScript(config)
+	sum := sha256.Sum256([]byte(h.script))
+	h.scriptETag = `"` + hex.EncodeToString(sum[:8]) + `"`
 	return h
 }
 
 func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-	if req.URL.Path != h.eventPath {
+	if !h.enabled {
+		h.upstream.ServeHTTP(resp, req)
+		return
+	}
+	h.collisionOnce.Do(func() {
+		go h.detectCollision()
+	})
+	path := h.trimBasePath(req.URL.Path)
+	isEventPath := path == h.eventPath ||
+		(h.ghostMode && path == h.ghostPath()) ||
+		(h.scriptPath != "" && path == h.scriptPath)
+	if isEventPath && !h.clientAllowed(req) {
+		http.Error(resp, "client not allowed", http.StatusForbidden)
+		return
+	}
+	if isEventPath && isPreflight(req) {
+		h.servePreflight(resp, req)
+		return
+	}
+	if h.scriptPath != "" && path == h.scriptPath {
+		h.serveScript(resp, req)
+		return
+	}
+	if h.ghostMode && path == h.ghostPath() {
+		h.setCORSHeader(resp.Header(), req)
+		h.serveGhost(resp, req)
+		return
+	}
+	if path != h.eventPath {
+		if isUpgrade(req) {
+			h.serveUpgrade(resp, req)
+			return
+		}
 		h.injectScript(resp, req)
 		return
 	}
+	h.setCORSHeader(resp.Header(), req)
 	if req.Method == http.MethodGet {
-		h.sseHandler.ServeHTTP(resp, req)
+		h.serveEvents(resp, req)
 		return
 	}
 	if req.Method == http.MethodPost {
+		err := h.checkTrigger(req)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusForbidden)
+			return
+		}
 		h.Reload()
 		return
 	}
@@ -99,73 +276,670 @@ func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	http.Error(resp, msg, http.StatusMethodNotAllowed)
 }
 
+// isUpgrade reports whether req asks to switch protocols,
+// such as to WebSocket.
+func isUpgrade(req *http.Request) bool {
+	return req.Header.Get("Upgrade") != "" &&
+		httpguts.HeaderValuesContainsToken(req.Header["Connection"], "upgrade")
+}
+
+// serveUpgrade passes a request that asks to switch protocols,
+// such as a WebSocket connection of the upstream webpages, to the upstream as-is,
+// since the upstream takes over the connection.
+func (h *Handler) serveUpgrade(resp http.ResponseWriter, req *http.Request) {
+	if h.requestRewrite != nil {
+		req = req.Clone(req.Context())
+		h.requestRewrite(req)
+	}
+	h.upstream.ServeHTTP(resp, req)
+}
+
 // Reload signals the webpages to reload.
 func (h *Handler) Reload() {
-	h.sseHandler.Publish("message", "reload")
+	h.publishReload("message", "reload")
+}
+
+// Publish sends an event with the given type and data to the webpages,
+// which pass it to the functions they registered for its type
+// using window.livereload.on, such as for re-running a test harness
+// or refreshing a data panel without reloading:
+//
+//	lr.Publish("theme", "dark")
+//
+//	// In the webpage:
+//	window.livereload = window.livereload || {};
+//	(window.livereload.queue = window.livereload.queue || []).push(["theme", function (data) {
+//		document.documentElement.dataset.theme = data;
+//	}]);
+//
+// window.livereload.on only exists once the injected script has run,
+// which is after the scripts in the head of the webpage,
+// so they register their functions by pushing them onto window.livereload.queue
+// as [type, fn] pairs, which the injected script registers once it runs.
+// Scripts that run after it, such as those run on the "load" event,
+// can also call window.livereload.on(type, fn) directly.
+//
+// The events of the types the script handles, such as "css",
+// also update the webpages like the methods of the Handler do.
+// See also [Handler.Events].
+func (h *Handler) Publish(eventType, data string) {
+	h.sseHandler.Publish(eventType, data)
+}
+
+// Reconnect closes the connections of the webpages to the event path,
+// directing them to reconnect shortly.
+// It's used when handing the address the Handler is served at
+// over to another process, such as a restarted one,
+// so that the webpages connect to the new process
+// instead of waiting for their connections to time out.
+func (h *Handler) Reconnect() {
+	h.sseHandler.Disconnect("reconnect", 100*time.Millisecond)
+}
+
+// closedRetry is how long the webpages wait
+// before reconnecting to a closed Handler, or the server replacing it.
+const closedRetry = time.Second
+
+// Close directs the webpages and tools connected to the event path to disconnect,
+// sending them a "server-closing" event, and waits until they do,
+// or until ctx is done, in which case it returns ctx.Err().
+// Later connections to the event path are directed to reconnect right away,
+// so that the server serving the Handler can shut down
+// without waiting for the webpages to disconnect on their own:
+//
+//	lr.Close(ctx)
+//	srv.Shutdown(ctx)
+//
+// The webpages reconnect once the server, or the one replacing it, is back up.
+// The Handler keeps serving the other requests, and can't be reopened.
+func (h *Handler) Close(ctx context.Context) error {
+	h.closed.Store(true)
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+	for {
+		// Disconnect repeatedly, since the clients that connected
+		// just before the Handler got closed may have missed the previous one.
+		h.sseHandler.Disconnect("server-closing", closedRetry)
+		if h.stats.clients.Load() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// serveClosed responds to a connection to the event path of a closed Handler
+// with a "server-closing" event, directing it to reconnect later.
+func (h *Handler) serveClosed(resp http.ResponseWriter, req *http.Request) {
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		http.Error(resp, "server closing", http.StatusServiceUnavailable)
+		return
+	}
+	header := resp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-store")
+	fmt.Fprintf(resp, "retry: %d\n%s", closedRetry.Milliseconds(), sse.Event{Type: "server-closing"})
+}
+
+// EventPath returns the event path,
+// including the one chosen by [WithRandomEventPath],
+// without the base path set by [WithBasePath].
+func (h *Handler) EventPath() string {
+	return h.eventPath
+}
+
+// Events returns the event stream served at the event path,
+// for publishing custom events to the webpages and the tools listening to it:
+//
+//	lr.Events().Publish("build", "started")
+//
+// The events of the types the script handles, such as "css",
+// update the webpages like the methods of the Handler do.
+func (h *Handler) Events() *sse.Handler {
+	return h.sseHandler
+}
+
+// Script returns the event listener script that's injected into HTML responses,
+// without the enclosing script tag.
+//
+// It's used for embedding the script in webpages that aren't served through the Handler,
+// such as by a server-side rendering app that includes it in its base template
+// and only routes the event path to the Handler:
+//
+//	lr := livereload.New(http.NotFoundHandler())
+//	mux.Handle(lr.EventPath(), lr)
+//	// In the base template: <script>{{ .LiveReloadScript }}</script>
+//	data.LiveReloadScript = template.JS(lr.Script())
+func (h *Handler) Script() string {
+	return h.script
 }
 
 // ==========
 
+// trimBasePath removes the base path set by [WithBasePath] from path, if it has it,
+// so that the event path is served whether or not
+// the reverse proxy in front of the Handler strips the base path.
+func (h *Handler) trimBasePath(path string) string {
+	if h.basePath == "" {
+		return path
+	}
+	p, ok := strings.CutPrefix(path, h.basePath)
+	if !ok || !strings.HasPrefix(p, "/") {
+		return path
+	}
+	return p
+}
+
+// setCORSHeader allows webpages of the origins set by [WithCORSOrigins]
+// to make requests to the event path, with credentials if [WithCredentials] is set,
+// and reports whether it did.
+func (h *Handler) setCORSHeader(header http.Header, req *http.Request) bool {
+	header.Add("Vary", "Origin")
+	origin := req.Header.Get("Origin")
+	if !h.corsAllowed(origin) {
+		return false
+	}
+	if h.credentials {
+		// The wildcard origin "*" is not allowed with credentials.
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Credentials", "true")
+		return true
+	}
+	if slices.Contains(h.corsOrigins, "*") {
+		origin = "*"
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	return true
+}
+
+// corsAllowed reports whether origin is allowed by [WithCORSOrigins].
+// The wildcard origin "*" doesn't apply with [WithCredentials],
+// so that credentials are only ever sent to the listed origins.
+func (h *Handler) corsAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if slices.Contains(h.corsOrigins, origin) {
+		return true
+	}
+	return !h.credentials && slices.Contains(h.corsOrigins, "*")
+}
+
+// isPreflight reports whether req is a [CORS] preflight request,
+// which browsers make before the cross-origin requests that aren't simple,
+// such as the ones with a JSON body.
+//
+// [CORS]: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// servePreflight responds to a CORS preflight request made to the event path,
+// allowing the request if the origin is allowed.
+func (h *Handler) servePreflight(resp http.ResponseWriter, req *http.Request) {
+	header := resp.Header()
+	if h.setCORSHeader(header, req) {
+		header.Set("Access-Control-Allow-Methods", "GET, POST")
+		if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		}
+		header.Set("Access-Control-Max-Age", "600")
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) serveEvents(resp http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Has("since") {
+		h.serveEventsSince(resp, req)
+		return
+	}
+	if h.closed.Load() {
+		h.serveClosed(resp, req)
+		return
+	}
+	if h.restarts != nil {
+		h.addListener()
+		defer h.removeListener()
+	}
+	defer h.clientConnected(req)()
+	initial := []sse.Event{{Type: "boot", Data: h.bootID}}
+	if warning := h.collisionWarning.Load(); warning != nil {
+		initial = append(initial, sse.Event{Type: "warning", Data: *warning})
+	}
+	if msg := h.buildError.Load(); msg != nil {
+		initial = append(initial, sse.Event{Type: "build-error", Data: *msg})
+	}
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		h.serveWebSocket(resp, req, initial)
+		return
+	}
+	h.sseHandler.Serve(resp, req, initial...)
+}
+
+// serveWebSocket serves the events over WebSocket.
+// Browsers don't apply CORS to WebSocket connections,
+// so connections from webpages of other origins are rejected,
+// unless their origin is allowed by [WithCORSOrigins] or [WithTrustedOrigins].
+func (h *Handler) serveWebSocket(resp http.ResponseWriter, req *http.Request, initial []sse.Event) {
+	srv := websocket.Server{
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			if h.corsAllowed(req.Header.Get("Origin")) {
+				return nil
+			}
+			return h.checkOrigin(req)
+		},
+		Handler: func(ws *websocket.Conn) {
+			h.sseHandler.ServeWebSocket(ws, initial...)
+		},
+	}
+	srv.ServeHTTP(resp, req)
+}
+
+// serveEventsSince responds with the events published
+// after the one whose sequence number is in the "since" query parameter,
+// for clients polling for events instead of listening for them,
+// and for webpages catching up on the events missed while disconnected.
+func (h *Handler) serveEventsSince(resp http.ResponseWriter, req *http.Request) {
+	since, err := strconv.ParseUint(req.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		http.Error(resp, "invalid since parameter", http.StatusBadRequest)
+		return
+	}
+	events, latest, complete := h.sseHandler.Since(since)
+	if events == nil {
+		events = []sse.Event{}
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(resp).Encode(eventsSince{
+		Seq:      latest,
+		Complete: complete,
+		Boot:     h.bootID,
+		Events:   events,
+	})
+}
+
+// eventsSince is the response of [Handler.serveEventsSince].
+type eventsSince struct {
+	// Seq is the sequence number of the last published event.
+	Seq uint64 `json:"seq"`
+
+	// Complete reports whether Events contains all the events
+	// published after the requested one.
+	// If not, some were dropped, or the sequence number is from a previous process.
+	Complete bool `json:"complete"`
+
+	// Boot is the boot ID of the Handler.
+	Boot string `json:"boot"`
+
+	Events []sse.Event `json:"events"`
+}
+
+// addListener registers a webpage listening for events,
+// and starts watching the upstream for restarts if it's the first one.
+func (h *Handler) addListener() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners++
+	if h.listeners == 1 {
+		ctx, cancel := context.WithCancel(context.Background())
+		h.stopRestarts = cancel
+		go h.restarts.watchRestarts(ctx, h.Reload)
+	}
+}
+
+// removeListener unregisters a webpage listening for events,
+// and stops watching the upstream for restarts if it was the last one.
+func (h *Handler) removeListener() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners--
+	if h.listeners == 0 {
+		h.stopRestarts()
+	}
+}
+
 func (h *Handler) injectScript(resp http.ResponseWriter, req *http.Request) {
 
+	// skip reports whether the response is passed through untouched.
+	skip := !h.shouldInject(req)
+
 	// Modify the request to indicate we don't accept response compression.
-	req.Header.Set("Accept-Encoding", "identity")
+	// The original header is kept for [FileServer],
+	// which serves precompressed files that aren't injected into.
+	acceptEncoding := req.Header.Get("Accept-Encoding")
+	if !skip {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+
+	// Propagate the ID of the request, or generate one,
+	// so that it can be correlated with the logs of the upstream.
+	setRequestID(req)
 
 	// buf stores the upstream response
 	// when we deduce we need to inject a script in it.
-	buf := new(bytes.Buffer)
+	buf := new(abortableBuffer)
+
+	// wasSniffed reports whether the response type was sniffed,
+	// since the upstream didn't specify it.
+	var wasSniffed bool
+
+	// encoding is the Content-Encoding of the response routed to buf,
+	// if the upstream compressed it anyway.
+	var encoding string
+
+	// skipReason is why the response is passed through, if it is.
+	var skipReason string
+
+	// xhtml reports whether the response is an XHTML document,
+	// which the script is inserted into without parsing it as HTML.
+	var xhtml bool
+
+	// gate keeps the upstream from writing to resp if it times out.
+	gate := new(timeoutGate)
 
 	// uresp is the upstream response writer.
 	uresp := resprouter.New(
-		func(uresp *resprouter.Router) (w io.Writer) {
+		gate.headerRouter(func(uresp *resprouter.Router) (w io.Writer) {
 			resprouter.CopyHeader(uresp.Header(), resp.Header())
-			if h.disableCaching {
-				resp.Header().Set("Cache-Control", "no-store")
+			resp.Header().Set(requestIDHeader, requestID(req))
+			if fixWASMHeader(req.URL.Path, resp.Header()) {
+				skipReason = "WebAssembly module"
+				return h.routeTo(resp, uresp, buf, resp)
+			}
+			if skip {
+				skipReason = "excluded by filter"
+				return h.routeTo(resp, uresp, buf, resp)
 			}
 			disp, _, _ := mime.ParseMediaType(uresp.Header().Get("Content-Disposition"))
 			if disp == "attachment" {
-				return resp
+				skipReason = "attachment"
+				return h.routeTo(resp, uresp, buf, resp)
+			}
+			if enc := uresp.Header().Get("Content-Encoding"); enc != "" && enc != "identity" {
+				if !decodableEncoding(enc) {
+					skipReason = "unsupported Content-Encoding " + enc
+					return h.routeTo(resp, uresp, buf, resp)
+				}
+				encoding = enc
+			}
+			contentType := uresp.Header().Get("Content-Type")
+			typ, _, _ := mime.ParseMediaType(contentType)
+			if typ == "text/html" && encoding == "" && h.streams() && !isUTF16(contentType) {
+				resp.Header().Del("Content-Length")
+				scriptAttrs, script := h.scriptTag(req, resp.Header())
+				sw, err := htmlpatch.NewScriptWriter(resp, scriptAttrs, script)
+				if err == nil {
+					return h.routeTo(resp, uresp, buf, sw)
+				}
 			}
-			typ, _, _ := mime.ParseMediaType(uresp.Header().Get("Content-Type"))
 			if typ == "text/html" || typ == "text/plain" {
-				return buf
-			} else if typ == "" {
+				return h.routeTo(resp, uresp, buf, buf)
+			} else if typ == "application/xhtml+xml" {
+				xhtml = true
+				return h.routeTo(resp, uresp, buf, buf)
+			} else if typ == "" && encoding == "" {
 				return nil
 			} else {
-				return resp
+				skipReason = "Content-Type " + typ
+				return h.routeTo(resp, uresp, buf, resp)
 			}
-		},
-		func(uresp *resprouter.Router, sniffed []byte) io.Writer {
+		}),
+		gate.sniffRouter(func(uresp *resprouter.Router, sniffed []byte) io.Writer {
+			wasSniffed = true
 			typ, _, _ := mime.ParseMediaType(http.DetectContentType(sniffed))
 			if typ == "text/html" || typ == "text/plain" {
-				return buf
+				return h.routeTo(resp, uresp, buf, buf)
 			} else {
-				return resp
+				skipReason = "sniffed Content-Type " + typ
+				return h.routeTo(resp, uresp, buf, resp)
 			}
-		},
+		}),
 	)
 
 	// Send the request upstream.
-	h.upstream.ServeHTTP(uresp, req)
+	// Panics are recovered, since net/http
+	// only recovers panics in the goroutine serving the request.
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	ctx = context.WithValue(ctx, acceptEncodingKey{}, acceptEncoding)
+	ureq := req.WithContext(ctx)
+	if h.requestRewrite != nil {
+		ureq = req.Clone(ctx)
+		h.requestRewrite(ureq)
+	}
+	finished := make(chan struct{})
+	var pnc *upstreamPanic
+	go func() {
+		defer close(finished)
+		defer func() {
+			if v := recover(); v != nil {
+				pnc = &upstreamPanic{value: v, stack: debug.Stack()}
+			}
+		}()
+		h.upstream.ServeHTTP(uresp, ureq)
+		// Route the response even if the upstream wrote nothing,
+		// like net/http does.
+		uresp.WriteHeader(http.StatusOK)
+	}()
+
+	var timeout <-chan time.Time
+	if h.upstreamTimeout > 0 {
+		t := time.NewTimer(h.upstreamTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
 
 	// Wait for the upstream response to get routed.
-	w := <-uresp.Done
+	var w io.Writer
+	select {
+	case w = <-uresp.Done:
+	case <-finished:
+		if pnc != nil && gate.timeOut(buf) {
+			h.handlePanic(resp, req, pnc, false)
+			return
+		}
+		w = <-uresp.Done
+	case <-timeout:
+		if gate.timeOut(buf) {
+			cancel()
+			h.writeTimeoutPage(resp, req)
+			return
+		}
+		w = <-uresp.Done
+	case <-req.Context().Done():
+		// The client is gone, so there's no one to respond to.
+		if gate.timeOut(buf) {
+			buf.abort()
+			return
+		}
+		w = <-uresp.Done
+	}
 
 	// If the upstream isn't routed to buf,
-	// it means we don't want to modify the response
-	// and there is nothing to do.
-	if w == resp {
+	// it means we don't want to modify the response, or it's modified as it streams,
+	// and there is nothing to do but to wait for the upstream to finish.
+	if w != buf {
+		<-finished
+		if sw, ok := w.(*htmlpatch.ScriptWriter); ok {
+			sw.Close()
+			h.injected()
+		} else if w == resp {
+			h.injectSkipped(req, skipReason)
+		}
+		if pnc != nil {
+			h.handlePanic(resp, req, pnc, true)
+		}
 		return
 	}
 
-	// Inject the script into the response.
+	// Wait for the upstream to finish writing the response to buf.
+	select {
+	case <-finished:
+		if pnc != nil {
+			h.handlePanic(resp, req, pnc, false)
+			return
+		}
+	case <-timeout:
+		gate.timeOut(buf)
+		buf.abort()
+		cancel()
+		h.writeTimeoutPage(resp, req)
+		return
+	case <-req.Context().Done():
+		// Stop buffering the response for the client that is gone,
+		// in case the upstream ignores the cancellation of its request.
+		gate.timeOut(buf)
+		buf.abort()
+		return
+	}
+
+	start := time.Now()
 	origHtml := buf.Bytes()
-	scriptAttrs := scriptNonceAttrs(resp.Header())
-	newHtml, err := htmlpatch.InsertScript(origHtml, scriptAttrs, h.script)
+	origSize := len(origHtml)
+
+	// Decode the response the upstream compressed despite being asked not to,
+	// and send it downstream uncompressed.
+	// Responses that fail to decode, or decode to more than maxDecodedSize,
+	// are passed through untouched.
+	if encoding != "" {
+		decoded, err := decodeContent(encoding, origHtml)
+		if err != nil {
+			h.injectSkipped(req, fmt.Sprintf("could not decode Content-Encoding %s: %s", encoding, err))
+			resp.WriteHeader(uresp.StatusCode)
+			resp.Write(origHtml)
+			return
+		}
+		origHtml = decoded
+		resp.Header().Del("Content-Encoding")
+		resp.Header().Del("Content-Length")
+	}
+
+	// Transcode documents in other character encodings, such as Shift_JIS,
+	// to UTF-8 for modifying them, and back once they're modified.
+	// Documents that fail to decode are passed through untouched.
+	// undecoded is kept for passing the documents that aren't modified through
+	// in their original encoding, as declared by their Content-Type.
+	undecoded := origHtml
+	enc := documentCharset(origHtml, resp.Header().Get("Content-Type"))
+	if enc != nil {
+		decoded, err := enc.NewDecoder().Bytes(origHtml)
+		if err != nil {
+			h.injectSkipped(req, fmt.Sprintf("could not decode charset: %s", err))
+			resp.WriteHeader(uresp.StatusCode)
+			resp.Write(origHtml)
+			return
+		}
+		origHtml = decoded
+	}
+
+	// Insert the script into XHTML documents as XML,
+	// without applying the HTML modifications.
+	if xhtml {
+		scriptAttrs, script := h.scriptTag(req, resp.Header())
+		newHtml, err := htmlpatch.InsertScriptXHTML(origHtml, scriptAttrs, script)
+		if err != nil {
+			h.injectFailed(req, err)
+			doc, _ := encodeCharset(enc, origHtml)
+			resp.WriteHeader(uresp.StatusCode)
+			resp.Write(doc)
+			return
+		}
+		h.writeInjected(resp, req, uresp.StatusCode, newHtml, enc, InjectStats{
+			OriginalSize: origSize,
+			Sniffed:      wasSniffed,
+		}, start)
+		return
+	}
+
+	// Pass XML documents such as standalone SVG images through untouched,
+	// since they'd get mangled by the HTML parser.
+	if htmlpatch.IsXML(origHtml) {
+		h.injectSkipped(req, "XML document")
+		resp.WriteHeader(uresp.StatusCode)
+		resp.Write(undecoded)
+		return
+	}
+
+	// Apply the HTML transforms.
+	for _, fn := range h.htmlTransforms {
+		transformed, err := fn(origHtml)
+		if err != nil {
+			err := fmt.Errorf("could not transform HTML: %w", err)
+			h.injectFailed(req, err)
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		origHtml = transformed
+	}
+
+	// Make relative URLs resolve against the proxy.
+	if h.baseHref != "" {
+		based, err := htmlpatch.SetBaseHref(origHtml, h.baseHref)
+		if err != nil {
+			err := fmt.Errorf("could not set the base href of HTML: %w", err)
+			h.injectFailed(req, err)
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		origHtml = based
+	}
+
+	// Refresh the webpages periodically if JavaScript is disabled.
+	if h.noscriptRefresh > 0 {
+		secs := int(math.Ceil(h.noscriptRefresh.Seconds()))
+		meta := fmt.Sprintf(`<meta http-equiv="refresh" content="%d">`, secs)
+		insert := htmlpatch.InsertNoscript
+		if h.preserveMarkup {
+			insert = func(doc []byte, html string) ([]byte, error) {
+				return htmlpatch.SpliceHTML(doc, htmlpatch.HeadEnd, "<noscript>"+html+"</noscript>")
+			}
+		}
+		refreshed, err := insert(origHtml, meta)
+		if err != nil {
+			err := fmt.Errorf("could not insert noscript into HTML: %w", err)
+			h.injectFailed(req, err)
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		origHtml = refreshed
+	}
+
+	// Inject the HTML snippets.
+	insertHTML := htmlpatch.InsertHTML
+	if h.preserveMarkup {
+		insertHTML = htmlpatch.SpliceHTML
+	}
+	for _, snip := range h.snippets {
+		injected, err := insertHTML(origHtml, snip.pos, snip.html)
+		if err != nil {
+			err := fmt.Errorf("could not insert snippet into HTML: %w", err)
+			h.injectFailed(req, err)
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		origHtml = injected
+	}
+
+	// Inject the script into the response.
+	// The document is left byte-for-byte identical apart from the script
+	// if the markup is preserved, and rendered otherwise.
+	insertScript := htmlpatch.InsertScript
+	if h.preserveMarkup {
+		insertScript = htmlpatch.SpliceScript
+	}
+	scriptAttrs, script := h.scriptTag(req, resp.Header())
+	newHtml, err := insertScript(origHtml, scriptAttrs, script)
 	if err != nil {
+		h.injectFailed(req, err)
 		if uresp.StatusCode != http.StatusOK {
+			doc, _ := encodeCharset(enc, origHtml)
 			resp.WriteHeader(uresp.StatusCode)
-			resp.Write(origHtml)
+			resp.Write(doc)
 		} else {
 			err := fmt.Errorf("could not insert script into HTML: %w", err)
 			http.Error(resp, err.Error(), http.StatusInternalServerError)
@@ -173,23 +947,256 @@ func (h *Handler) injectScript(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Send the modified response downstream.
+	if !h.preserveMarkup {
+		newHtml = append(newHtml, '\n')
+	}
+	h.writeInjected(resp, req, uresp.StatusCode, newHtml, enc, InjectStats{
+		OriginalSize: origSize,
+		Sniffed:      wasSniffed,
+	}, start)
+}
+
+// writeInjected sends the document the script was injected into downstream,
+// encoded using enc, and reports the injection.
+// The modified size and the elapsed time of stats are filled in.
+func (h *Handler) writeInjected(
+	resp http.ResponseWriter,
+	req *http.Request,
+	status int,
+	doc []byte,
+	enc encoding.Encoding,
+	stats InjectStats,
+	start time.Time,
+) {
+	doc, err := encodeCharset(enc, doc)
+	if err != nil {
+		err := fmt.Errorf("could not encode charset: %w", err)
+		h.injectFailed(req, err)
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats.ModifiedSize = len(doc)
+	stats.Elapsed = time.Since(start)
 	resp.Header().Del("Content-Length")
-	resp.WriteHeader(uresp.StatusCode)
-	resp.Write(append(newHtml, '\n'))
+	resp.WriteHeader(status)
+	resp.Write(doc)
+	h.injected()
+
+	if h.onInject != nil {
+		h.onInject(req, stats)
+	}
+}
+
+// streams reports whether the script is injected into HTML responses
+// as they stream, which isn't possible if they're modified otherwise, too.
+func (h *Handler) streams() bool {
+	return h.streaming &&
+		len(h.htmlTransforms) == 0 &&
+		h.baseHref == "" &&
+		h.noscriptRefresh == 0 &&
+		len(h.snippets) == 0
+}
+
+// InjectStats describes the injection of the script into a response.
+// See [WithOnInject].
+type InjectStats struct {
+	// OriginalSize is the size of the upstream response in bytes.
+	OriginalSize int
+
+	// ModifiedSize is the size of the response sent downstream in bytes.
+	ModifiedSize int
+
+	// Sniffed reports whether the response was detected to be HTML
+	// by sniffing its content, since the upstream didn't specify its type.
+	Sniffed bool
+
+	// Elapsed is the time spent modifying the response,
+	// excluding the time spent waiting for the upstream.
+	Elapsed time.Duration
+}
+
+// routeTo sets the headers of resp for routing the upstream response to w,
+// which is either resp itself, buf for injecting the script,
+// or a [htmlpatch.ScriptWriter] for injecting it as the response streams,
+// and returns w.
+// The header is written to resp unless w is buf.
+func (h *Handler) routeTo(resp http.ResponseWriter, uresp *resprouter.Router, buf *abortableBuffer, w io.Writer) io.Writer {
+	if h.disableCaching {
+		if _, ok := w.(*htmlpatch.ScriptWriter); ok || w == buf {
+			resp.Header().Set("Cache-Control", "no-store")
+		} else if h.assetCacheControl != "" {
+			resp.Header().Set("Cache-Control", h.assetCacheControl)
+		}
+	}
+	if h.responseHeader != nil {
+		h.responseHeader(resp.Header())
+	}
+	if w != buf {
+		resp.WriteHeader(uresp.StatusCode)
+	}
+	return w
+}
+
+// writeTimeoutPage responds with an error page
+// stating that the upstream didn't respond in time.
+func (h *Handler) writeTimeoutPage(resp http.ResponseWriter, req *http.Request) {
+	h.writeErrorPage(resp, errorPage{
+		Status: http.StatusGatewayTimeout,
+		Title:  "Upstream timed out",
+		Message: fmt.Sprintf(
+			"The upstream didn't respond to %s %s within %s.",
+			req.Method, req.URL.Path, h.upstreamTimeout,
+		),
+		RequestID: requestID(req),
+	})
+}
+
+// timeoutGate keeps the upstream from writing to the downstream response
+// once the upstream has timed out and the response is used for an error page.
+// Responses that are already being written downstream don't time out.
+type timeoutGate struct {
+	mu       sync.Mutex
+	routed   io.Writer
+	timedOut bool
+}
+
+func (g *timeoutGate) headerRouter(fn resprouter.HeaderRouter) resprouter.HeaderRouter {
+	return func(r *resprouter.Router) io.Writer {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.timedOut {
+			return io.Discard
+		}
+		g.routed = fn(r)
+		return g.routed
+	}
+}
+
+func (g *timeoutGate) sniffRouter(fn resprouter.SniffRouter) resprouter.SniffRouter {
+	return func(r *resprouter.Router, sniffed []byte) io.Writer {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.timedOut {
+			return io.Discard
+		}
+		g.routed = fn(r, sniffed)
+		return g.routed
+	}
+}
+
+// timeOut closes the gate and reports whether it did,
+// which it doesn't if the upstream is already routed downstream rather than to buf.
+func (g *timeoutGate) timeOut(buf io.Writer) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.routed != nil && g.routed != buf {
+		return false
+	}
+	g.timedOut = true
+	return true
+}
+
+// errAborted is returned when writing to an aborted [abortableBuffer].
+var errAborted = errors.New("the response is no longer needed")
+
+// abortableBuffer is a buffer that the upstream writes its response to,
+// which can be aborted to discard the response
+// and make further writes fail, which stops most upstreams.
+type abortableBuffer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	aborted bool
+}
+
+func (b *abortableBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.aborted {
+		return 0, errAborted
+	}
+	return b.buf.Write(p)
+}
+
+// abort discards the buffered response and makes further writes fail.
+func (b *abortableBuffer) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.aborted = true
+	b.buf = bytes.Buffer{}
+}
+
+// Bytes returns the buffered response.
+// It must only be called once the upstream is finished writing.
+func (b *abortableBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// fixWASMHeader prepares the header of the response to a request for path
+// if it's a WebAssembly module, and reports whether it is.
+//
+// WebAssembly.instantiateStreaming() requires the "application/wasm" type,
+// which some file servers don't know about.
+// WebAssembly modules are also never cached,
+// since browsers cache their compiled code by URL.
+func fixWASMHeader(path string, h http.Header) bool {
+	if !strings.HasSuffix(path, ".wasm") {
+		return false
+	}
+	typ, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if typ == "" || typ == "application/octet-stream" {
+		h.Set("Content-Type", "application/wasm")
+	} else if typ != "application/wasm" {
+		return false
+	}
+	h.Set("Cache-Control", "no-store")
+	return true
+}
+
+// scriptTag returns the attributes and the content
+// of the script tag to inject into the response to req with the given header:
+// the script itself, or a reference to it if it's served by [WithExternalScript].
+func (h *Handler) scriptTag(req *http.Request, header http.Header) (attrs []html.Attribute, content string) {
+	attrs = scriptNonceAttrs(h.scriptNonce(req, header))
+	if h.scriptPath == "" {
+		return attrs, h.script
+	}
+	return append(attrs, html.Attribute{Key: "src", Val: h.basePath + h.scriptPath}), ""
+}
+
+// serveScript serves the event listener script at the path set by [WithExternalScript].
+// Browsers revalidate it on each load, so that it's updated along with the Handler.
+func (h *Handler) serveScript(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		msg := fmt.Sprintf("method not allowed: %q", req.Method)
+		http.Error(resp, msg, http.StatusMethodNotAllowed)
+		return
+	}
+	header := resp.Header()
+	header.Set("Content-Type", "text/javascript; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("ETag", h.scriptETag)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if req.Header.Get("If-None-Match") == h.scriptETag {
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if req.Method == http.MethodHead {
+		header.Set("Content-Length", strconv.Itoa(len(h.script)))
+		return
+	}
+	io.WriteString(resp, h.script)
 }
 
 // scriptNonceAttrs returns a set of attributes containing a nonce attribute
-// that matches the nonce specified in the Content-Security-Policy header.
+// set to nonce, or nil if nonce is empty.
 //
-// Script tags without their "nonce" attribute set to this value
+// Script tags without their "nonce" attribute set to
+// the nonce specified in the Content-Security-Policy header
 // won't be executed by the browser.
 //
 // See https://developer.mozilla.org/en-US/docs/Web/HTTP/CSP#nonces
 // for details.
-func scriptNonceAttrs(h http.Header) []html.Attribute {
-	csp := h.Get("Content-Security-Policy")
-	nonce := cspScriptNonce(csp)
+func scriptNonceAttrs(nonce string) []html.Attribute {
 	if nonce == "" {
 		return nil
 	}
@@ -201,6 +1208,12 @@ func scriptNonceAttrs(h http.Header) []html.Attribute {
 	}
 }
 
+// headerScriptNonce returns the script-src nonce
+// specified in the Content-Security-Policy header of a response.
+func headerScriptNonce(req *http.Request, h http.Header) string {
+	return cspScriptNonce(h.Get("Content-Security-Policy"))
+}
+
 // cspScriptNonce parses a "Content-Security-Policy" http header value
 // and extracts the script-src nonce value from it if available.
 func cspScriptNonce(csp string) string {
@@ -224,28 +1237,238 @@ func cspScriptNonce(csp string) string {
 	return ""
 }
 
+//go:embed script.js
+var scriptTemplate string
+
+// scriptConfig is passed to the event listener script.
+type scriptConfig struct {
+	URL         string `json:"url"`
+	Credentials bool   `json:"credentials,omitempty"`
+	GhostURL    string `json:"ghostURL,omitempty"`
+	Token       string `json:"token,omitempty"`
+	Toolbar     bool   `json:"toolbar,omitempty"`
+	Transport   string `json:"transport,omitempty"`
+	Boot        string `json:"boot"`
+}
+
 // createScript returns javascript code
-// that listens to the [Server-Sent Events] emitted at eventURL
-// and reloads the page if an event with type "message" and data "reload" is received.
+// that listens to the [Server-Sent Events] emitted at config.URL
+// and reloads the page if an event with type "message" and data "reload" is received,
+// or re-fetches stylesheets and images in place upon receiving "css" and "image" events.
 //
 // [Server-Sent Events]: https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events
-func createScript(eventURL string) string {
-	script := `
-(new EventSource("{URL}")).onmessage = function(msg) {
-	if (msg && msg.data === "reload") {
-		window.location.reload()
-	}
-}
-`
-	eventURL = template.JSEscapeString(eventURL)
-	script = strings.ReplaceAll(script, "{URL}", eventURL)
-	return script
+func createScript(config scriptConfig) string {
+	// json.Marshal escapes "<", ">" and "&",
+	// so the config can't break out of the script tag.
+	b, _ := json.Marshal(config)
+	script := strings.ReplaceAll(scriptTemplate, "{CONFIG}", string(b))
+	return "\n" + script
 }
 
 // ==========
 
 type Option func(h *Handler)
 
+// WithRequestRewrite sets a function that modifies
+// the requests passed to the upstream,
+// such as for adjusting their headers, adding correlation IDs
+// or stripping credentials, without needing a separate middleware.
+// It's given a copy of each request, which it may modify freely.
+// Requests made to the event path aren't passed to the upstream,
+// and so aren't affected.
+func WithRequestRewrite(fn func(req *http.Request)) Option {
+	return func(h *Handler) {
+		h.requestRewrite = fn
+	}
+}
+
+// WithResponseHeader sets a function that modifies
+// the headers of the upstream responses before they're sent,
+// such as for adding development-only headers to every response,
+// like CORS headers, or the COOP and COEP headers
+// needed for testing SharedArrayBuffer.
+func WithResponseHeader(fn func(header http.Header)) Option {
+	return func(h *Handler) {
+		h.responseHeader = fn
+	}
+}
+
+// WithOnInject sets a function that is called
+// after the script is injected into a response,
+// with statistics about the injection,
+// such as for feeding them to a metrics or logging system.
+// It's called from the goroutine serving the request,
+// so it should return quickly.
+func WithOnInject(fn func(req *http.Request, stats InjectStats)) Option {
+	return func(h *Handler) {
+		h.onInject = fn
+	}
+}
+
+// WithScriptNonce sets a function that returns the nonce
+// to set on the injected script tag, given the request
+// and the header of the upstream response,
+// for when the upstream doesn't specify the nonce
+// in the Content-Security-Policy header of its responses,
+// such as when it's specified in another header,
+// or in the context of the request by an outer middleware.
+// Empty means the script tag has no nonce.
+//
+// Defaults to the script-src nonce
+// specified in the Content-Security-Policy header.
+func WithScriptNonce(fn func(req *http.Request, header http.Header) string) Option {
+	return func(h *Handler) {
+		h.scriptNonce = fn
+	}
+}
+
+// WithExternalScript makes the Handler serve the event listener script at path,
+// such as "/livereload.js", and inject a script tag that references it
+// instead of the script itself, for webpages whose Content-Security-Policy
+// only allows scripts from their own origin, such as with "script-src 'self'".
+// The nonce set by [WithScriptNonce] is still set on the script tag, if any.
+//
+// Defaults to "", which injects the script itself.
+func WithExternalScript(path string) Option {
+	return func(h *Handler) {
+		h.scriptPath = path
+	}
+}
+
+// WithHTMLTransform adds a function that modifies
+// the HTML responses before the script is injected into them,
+// such as for removing analytics scripts
+// using [htmlpatch.RemoveNodes] when proxying near-production HTML.
+// It can be used multiple times to add multiple functions,
+// which are applied in order.
+func WithHTMLTransform(fn func(html []byte) ([]byte, error)) Option {
+	return func(h *Handler) {
+		h.htmlTransforms = append(h.htmlTransforms, fn)
+	}
+}
+
+// WithStreaming configures whether the script is injected
+// into HTML responses as they're written by the upstream,
+// instead of once they're complete,
+// for large webpages and upstreams that stream them progressively.
+// Only the beginning of the responses is buffered, until the end of the head is found,
+// and the flushes of the upstream are passed through after that.
+//
+// The responses are never parsed and rendered, so missing elements aren't added,
+// and [WithOnInject] isn't called for them.
+// Responses that are compressed or plain text, and all responses if any of
+// [WithHTMLTransform], [WithBaseHref], [WithNoscriptRefresh] or [WithInjectHTML] is used,
+// are buffered regardless.
+//
+// Defaults to false.
+func WithStreaming(v bool) Option {
+	return func(h *Handler) {
+		h.streaming = v
+	}
+}
+
+// WithPreserveMarkup configures whether to splice the script,
+// and the elements of [WithNoscriptRefresh] and [WithInjectHTML],
+// into the HTML responses as they are,
+// leaving them byte-for-byte identical apart from the inserted elements,
+// instead of parsing and rendering them,
+// which normalizes their attribute quoting, self-closing tags and whitespace.
+// Missing elements such as the head tag aren't added; browsers create them implicitly.
+// The [WithBaseHref] option still renders the responses.
+//
+// Documents that the rendering might not preserve,
+// such as those with comments or custom elements, are always spliced into.
+//
+// Defaults to false.
+func WithPreserveMarkup(v bool) Option {
+	return func(h *Handler) {
+		h.preserveMarkup = v
+	}
+}
+
+// WithInjectFilter sets a function that reports
+// whether the script may be injected into the response to req,
+// such as for excluding API routes or admin panels.
+// Responses that aren't HTML or plain text are never injected into.
+//
+// Defaults to skipping the requests made by webpages using fetch or XMLHttpRequest,
+// such as for HTML fragments that are inserted into the webpages,
+// which browsers mark using the "Sec-Fetch-Dest: empty" header.
+// See also [WithSkipPaths].
+func WithInjectFilter(fn func(req *http.Request) bool) Option {
+	return func(h *Handler) {
+		h.injectFilter = fn
+	}
+}
+
+// WithSkipPaths excludes the responses to requests for the URL paths
+// matching any of the given patterns from script injection,
+// regardless of [WithInjectFilter].
+// The patterns have the syntax of [path.Match],
+// and patterns ending in a slash match the paths under them, too:
+//
+//	livereload.WithSkipPaths("/api/", "/admin/", "/partials/*.html")
+func WithSkipPaths(patterns ...string) Option {
+	return func(h *Handler) {
+		h.skipPaths = append(h.skipPaths, patterns...)
+	}
+}
+
+// WithBaseHref sets the href of the base tag of the HTML responses,
+// inserting one if there is none,
+// so that their relative URLs resolve against href.
+// This is useful when serving an upstream under a different path
+// than the one it expects, such as "/app/".
+func WithBaseHref(href string) Option {
+	return func(h *Handler) {
+		h.baseHref = href
+	}
+}
+
+// WithNoscriptRefresh makes the HTML responses refresh themselves
+// every interval, rounded up to whole seconds,
+// in browsers with JavaScript disabled, where the script can't run,
+// such as e-ink and embedded browsers.
+// It uses a refresh meta tag inside a noscript tag,
+// which browsers with JavaScript enabled ignore.
+//
+// Defaults to 0, which disables this.
+func WithNoscriptRefresh(interval time.Duration) Option {
+	return func(h *Handler) {
+		h.noscriptRefresh = interval
+	}
+}
+
+// snippet is an HTML snippet added by [WithInjectHTML].
+type snippet struct {
+	pos  htmlpatch.Position
+	html string
+}
+
+// WithInjectHTML adds an HTML snippet to inject into the HTML responses at pos,
+// such as a debug toolbar, meta tags or stubs of analytics scripts,
+// so that it's only present during development.
+// It can be used multiple times to add multiple snippets,
+// which are injected in order.
+func WithInjectHTML(pos htmlpatch.Position, html string) Option {
+	return func(h *Handler) {
+		h.snippets = append(h.snippets, snippet{pos, html})
+	}
+}
+
+// WithEnabled configures whether the Handler does anything at all.
+// A disabled Handler passes all requests to the upstream untouched,
+// including those made to the event path,
+// so that the same handler setup can be used in production,
+// with live reloading enabled by a single flag.
+//
+// Defaults to true.
+func WithEnabled(v bool) Option {
+	return func(h *Handler) {
+		h.enabled = v
+	}
+}
+
 // WithDisableCaching configures whether to direct browsers
 // to not cache our responses.
 //
@@ -256,6 +1479,108 @@ func WithDisableCaching(v bool) Option {
 	}
 }
 
+// WithAssetCacheControl sets the Cache-Control header
+// of the responses the script isn't injected into,
+// such as scripts, stylesheets and images,
+// while caching is disabled using [WithDisableCaching].
+// The responses the script is injected into always get "no-store".
+//
+// Empty leaves the header set by the upstream as-is,
+// and "no-cache" lets browsers keep the responses
+// but makes them revalidate the responses before using them,
+// which avoids re-downloading large unchanged assets
+// from upstreams that support conditional requests.
+//
+// Defaults to "no-store".
+func WithAssetCacheControl(value string) Option {
+	return func(h *Handler) {
+		h.assetCacheControl = value
+	}
+}
+
+// WithRestartDetection configures whether to reload the webpages
+// when the upstream appears to have been restarted,
+// such as by an external file watcher.
+// Only upstreams created by [ReverseProxy] support this.
+//
+// A connection to the upstream is kept open, and once it's dropped,
+// the webpages are reloaded when the upstream starts accepting connections again
+// after refusing them.
+// A restart is missed if the upstream is already accepting connections again
+// by the time the connection is redialed right after being dropped,
+// such as if it restarts very quickly or hands its listener over to the new process,
+// or if the connection is never dropped.
+// Use [Handler.Reload] or a [Runner] to reload the webpages reliably.
+//
+// Defaults to true.
+func WithRestartDetection(v bool) Option {
+	return func(h *Handler) {
+		h.restartDetection = v
+	}
+}
+
+// WithReloadKind sets how webpages are updated
+// after a file with the given extension (such as ".css") changes.
+// It can be used multiple times to configure multiple extensions,
+// such as for hot reloading JavaScript modules:
+//
+//	livereload.WithReloadKind(".js", livereload.ReloadModule)
+//
+// The leading dot of the extension is optional.
+// See [Handler.ReloadKindOf] for the defaults.
+func WithReloadKind(ext string, kind ReloadKind) Option {
+	return func(h *Handler) {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		h.reloadKinds[strings.ToLower(ext)] = kind
+	}
+}
+
+// WithReloadDebounce makes the Handler collapse the reloads
+// sent within d of each other into one, sent once no more reloads are sent for d,
+// such as when a build tool writes many files per build.
+// If any of the collapsed reloads reloads the whole webpages,
+// only that is sent; otherwise, the distinct in-place updates,
+// such as those of stylesheets, are sent together.
+//
+// Defaults to 0, which sends every reload right away.
+func WithReloadDebounce(d time.Duration) Option {
+	return func(h *Handler) {
+		h.reloadDebounce = d
+	}
+}
+
+// WithGhostMode configures whether to mirror scrolling, clicks and form input
+// across all the webpages open at the same path,
+// such as on a desktop and a phone.
+//
+// The webpages report their interactions
+// by making POST requests to the event path suffixed with "/ghost".
+// The input of file fields isn't mirrored,
+// nor is that of sensitive fields, such as passwords, one-time codes
+// and fields with an autocomplete attribute for credit card details.
+//
+// Defaults to false.
+func WithGhostMode(v bool) Option {
+	return func(h *Handler) {
+		h.ghostMode = v
+	}
+}
+
+// WithToolbar configures whether the webpages show a small floating toolbar
+// with the state of the connection to the Handler,
+// the time of the last reload and the number of reloads,
+// and buttons for reloading the webpage and for turning auto-reload off,
+// which makes the webpages wait for the reload button to be pressed instead.
+//
+// Defaults to false.
+func WithToolbar(v bool) Option {
+	return func(h *Handler) {
+		h.toolbar = v
+	}
+}
+
 // WithEventPath sets the path of the reload events webpages listen to.
 // Set it to something that doesn't shadow the paths of the upstream.
 //
@@ -266,18 +1591,186 @@ func WithEventPath(path string) Option {
 	}
 }
 
-// ==========
+// WithUpstreamTimeout sets how long to wait for the upstream
+// to respond to a request before responding with an error page instead.
+// Responses that are passed through unmodified
+// only need to start within this duration, and are not cut off.
+//
+// Defaults to zero, meaning no timeout.
+func WithUpstreamTimeout(d time.Duration) Option {
+	return func(h *Handler) {
+		h.upstreamTimeout = d
+	}
+}
 
-// ReverseProxy returns an [http.Handler]
-// that sends it's requests to the given upstream URL
-// and returns it's responses.
-func ReverseProxy(upstream *url.URL) http.Handler {
-	p := httputil.NewSingleHostReverseProxy(upstream)
-	p.Transport = retrier.New(500*time.Millisecond, 10*time.Second)
-	origDirector := p.Director
-	p.Director = func(req *http.Request) {
-		origDirector(req)
-		req.Host = ""
+// WithRandomEventPath sets the event path to a random path
+// such as "/livereload-3f2a9c1e0b7d4a65",
+// which won't collide with the paths of the upstream.
+// The event listener script is always configured with the generated path.
+func WithRandomEventPath() Option {
+	return func(h *Handler) {
+		h.eventPath = "/livereload-" + randomHex(8)
 	}
-	return p
+}
+
+// WithBasePath sets the path prefix the Handler is reachable at by the webpages,
+// such as "/app", for when it's behind a reverse proxy
+// that serves it under that prefix, such as a shared ingress.
+// The URLs in the injected script, such as the event URL, include the prefix,
+// and the event path is served both with and without it,
+// whether or not the reverse proxy strips it.
+//
+// Defaults to no prefix.
+func WithBasePath(prefix string) Option {
+	return func(h *Handler) {
+		h.basePath = strings.TrimSuffix("/"+strings.Trim(prefix, "/"), "/")
+	}
+}
+
+// WithCORSOrigins sets the origins (such as "http://localhost:3000")
+// whose webpages are allowed to connect to the event path,
+// for when the HTML is served from another origin or port than the Handler,
+// such as with [WithEventURL].
+// The origin "*" allows all origins, unless [WithCredentials] is set.
+//
+// The responses to requests made to the event path include [CORS] headers
+// that allow the origins, and preflight requests are answered.
+// Reloads triggered by POST requests from other origins
+// are still subject to [WithCSRFProtection].
+//
+// Defaults to no origins.
+//
+// [CORS]: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS
+func WithCORSOrigins(origins ...string) Option {
+	return func(h *Handler) {
+		h.corsOrigins = append(h.corsOrigins, origins...)
+	}
+}
+
+// WithEventURL sets the URL the webpages connect to for receiving events,
+// for when the event path of the Handler
+// is reachable by the webpages at a different URL,
+// such as on another origin.
+// See also [WithCredentials].
+//
+// Defaults to the event path.
+func WithEventURL(url string) Option {
+	return func(h *Handler) {
+		h.eventURL = url
+	}
+}
+
+// Transport is the protocol the webpages receive the events over.
+// See [WithTransport].
+type Transport int
+
+const (
+	// TransportSSE sends the events using [Server-Sent Events].
+	//
+	// [Server-Sent Events]: https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events
+	TransportSSE Transport = iota
+
+	// TransportWebSocket sends the events over a [WebSocket] connection,
+	// for when a proxy between the browser and the Handler
+	// buffers or times out Server-Sent Events.
+	//
+	// [WebSocket]: https://developer.mozilla.org/en-US/docs/Web/API/WebSockets_API
+	TransportWebSocket
+)
+
+// WithTransport sets the protocol the webpages use
+// to receive the events from the event path.
+// The event path accepts connections of both protocols regardless,
+// so tools connecting to it can use either.
+//
+// Defaults to [TransportSSE].
+func WithTransport(t Transport) Option {
+	return func(h *Handler) {
+		h.transport = t
+	}
+}
+
+// WithEventOptions sets the options of the event stream served at the event path,
+// such as its keep-alive interval:
+//
+//	livereload.WithEventOptions(sse.WithKeepAlive(30 * time.Second))
+func WithEventOptions(options ...sse.Option) Option {
+	return func(h *Handler) {
+		h.sseOptions = append(h.sseOptions, options...)
+	}
+}
+
+// WithCredentials configures whether the webpages
+// send credentials such as cookies when connecting to the event URL,
+// for when it's on another origin and protected by authentication.
+//
+// When enabled, the responses to requests made to the event path
+// include [CORS] headers that allow credentials from the origins
+// set by [WithCORSOrigins], which must be listed explicitly;
+// the wildcard origin "*" doesn't apply to requests with credentials.
+// Requests from other origins get no CORS headers, so browsers block them.
+//
+// Defaults to false.
+//
+// [CORS]: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS
+func WithCredentials(v bool) Option {
+	return func(h *Handler) {
+		h.credentials = v
+	}
+}
+
+// WithCSRFProtection configures whether to reject
+// POST requests to the event path made by webpages of other origins,
+// so that the webpages open in the browser can't trigger reloads.
+// Requests not made by browsers, such as those made by build tools, are allowed.
+//
+// Defaults to true.
+func WithCSRFProtection(v bool) Option {
+	return func(h *Handler) {
+		h.csrfProtection = v
+	}
+}
+
+// WithTrustedOrigins sets the origins (such as "http://localhost:3000")
+// whose webpages are allowed to make POST requests to the event path
+// despite CSRF protection.
+//
+// See [WithCSRFProtection].
+func WithTrustedOrigins(origins ...string) Option {
+	return func(h *Handler) {
+		h.trustedOrigins = append(h.trustedOrigins, origins...)
+	}
+}
+
+// WithAllowedClients restricts the use of the event path,
+// for both listening to and triggering events,
+// to clients whose IP addresses are within the given prefixes,
+// such as netip.MustParsePrefix("10.0.0.0/8").
+// The IP address is taken from [http.Request.RemoteAddr];
+// forwarding headers such as "X-Forwarded-For" are not trusted.
+//
+// Defaults to allowing all clients.
+func WithAllowedClients(prefixes ...netip.Prefix) Option {
+	return func(h *Handler) {
+		h.allowedClients = append(h.allowedClients, prefixes...)
+	}
+}
+
+// WithTriggerToken requires POST requests to the event path
+// to include the given token,
+// either in the "X-Livereload-Token" header or the "token" query parameter.
+// The event listener script includes the token in it's own requests.
+//
+// Defaults to no token.
+func WithTriggerToken(token string) Option {
+	return func(h *Handler) {
+		h.triggerToken = token
+	}
+}
+
+// randomHex returns n random bytes encoded as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
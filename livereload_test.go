@@ -5,15 +5,40 @@ package livereload_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"github.com/koonix/go-livereload"
+	"github.com/koonix/go-livereload/htmlpatch"
+	"github.com/koonix/go-livereload/sse"
+	"golang.org/x/net/websocket"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
 )
 
 func Example_fileServer() {
@@ -86,6 +111,53 @@ func TestLiveReload(t *testing.T) {
 		}
 	})
 
+	t.Run("asset-cache-control", func(t *testing.T) {
+		tests := []struct {
+			body []byte
+			want string
+		}{
+			{htmlContent, "no-store"},
+			{[]byte("\x00binary"), "no-cache"},
+		}
+		for _, test := range tests {
+			upstream := &handler{
+				Body: test.body,
+			}
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatalf("could not create request: %s", err)
+			}
+			option := livereload.WithAssetCacheControl("no-cache")
+			livereload.New(upstream, option).ServeHTTP(resp, req)
+			if got := resp.Header().Get("Cache-Control"); got != test.want {
+				t.Errorf("incorrect Cache-Control header; want %q, got %q", test.want, got)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		for _, target := range []string{"/", "/livereloadevents"} {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, target, nil)
+			if err != nil {
+				t.Fatalf("could not create request: %s", err)
+			}
+			option := livereload.WithEnabled(false)
+			livereload.New(upstream, option).ServeHTTP(resp, req)
+			body, _ := io.ReadAll(resp.Result().Body)
+			if !bytes.Equal(body, content) {
+				t.Errorf("response of disabled handler is modified")
+			}
+			if resp.Header().Get("Cache-Control") != "" {
+				t.Errorf("incorrect Cache-Control header")
+			}
+		}
+	})
+
 	t.Run("no-content-type-html", func(t *testing.T) {
 		upstream := &handler{
 			Body: htmlContent,
@@ -145,162 +217,2291 @@ func TestLiveReload(t *testing.T) {
 		}
 	})
 
-	t.Run("content-type-other", func(t *testing.T) {
+	t.Run("streaming", func(t *testing.T) {
+		release := make(chan struct{})
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "text/html")
+			resp.WriteHeader(http.StatusAccepted)
+			io.WriteString(resp, "<html><head><title>t</title></head><body>")
+			resp.(http.Flusher).Flush()
+			<-release
+			io.WriteString(resp, "hello</body></html>")
+		})
+		srv := httptest.NewServer(livereload.New(upstream, livereload.WithStreaming(true)))
+		defer srv.Close()
+		defer close(release)
+
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("could not get: %s", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("incorrect status; want %d, got %d", http.StatusAccepted, resp.StatusCode)
+		}
+
+		// The flushed beginning arrives while the upstream is still writing.
+		var got []byte
+		chunk := make([]byte, 4096)
+		for !bytes.Contains(got, []byte("<body>")) {
+			n, err := resp.Body.Read(chunk)
+			got = append(got, chunk[:n]...)
+			if err != nil {
+				t.Fatalf("could not read the flushed beginning: %s", err)
+			}
+		}
+		if !bytes.Contains(got, script) {
+			t.Errorf("script not injected into the flushed beginning: %q", got)
+		}
+		if !bytes.HasSuffix(got, []byte("</script></head><body>")) {
+			t.Errorf("script not inserted at the end of the head: %q", got)
+		}
+	})
+
+	t.Run("reload-debounce", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			reload func(lr *livereload.Handler)
+			want   []string
+		}{
+			{"full", func(lr *livereload.Handler) {
+				lr.ReloadFiles("style.css")
+				lr.Reload()
+				lr.Reload()
+			}, []string{"message:reload"}},
+			{"in-place", func(lr *livereload.Handler) {
+				lr.ReloadFiles("style.css")
+				lr.ReloadFiles("style.css", "logo.png")
+			}, []string{"css:style.css", "image:logo.png"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var mu sync.Mutex
+				var reloads []string
+				lr := livereload.New(http.NotFoundHandler(),
+					livereload.WithReloadDebounce(30*time.Millisecond),
+					livereload.WithOnReload(func(ev sse.Event) {
+						mu.Lock()
+						defer mu.Unlock()
+						reloads = append(reloads, ev.Type+":"+ev.Data)
+					}),
+				)
+				tt.reload(lr)
+				mu.Lock()
+				if len(reloads) != 0 {
+					t.Errorf("reloads sent before the debounce duration: %q", reloads)
+				}
+				mu.Unlock()
+				time.Sleep(100 * time.Millisecond)
+				mu.Lock()
+				defer mu.Unlock()
+				if !slices.Equal(reloads, tt.want) {
+					t.Errorf("incorrect reloads; want %q, got %q", tt.want, reloads)
+				}
+			})
+		}
+	})
+
+	t.Run("observability", func(t *testing.T) {
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/logo.png" {
+				resp.Header().Set("Content-Type", "image/png")
+				return
+			}
+			resp.Header().Set("Content-Type", "text/html")
+			resp.Write(content)
+		})
+		var reloads []string
+		var connects, disconnects int
+		var logs bytes.Buffer
+		lr := livereload.New(upstream,
+			livereload.WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+			livereload.WithOnReload(func(ev sse.Event) {
+				reloads = append(reloads, ev.Type+":"+ev.Data)
+			}),
+			livereload.WithOnClientConnect(func(req *http.Request) { connects++ }),
+			livereload.WithOnClientDisconnect(func(req *http.Request) { disconnects++ }),
+		)
+
+		for _, path := range []string{"/", "/logo.png"} {
+			lr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "/livereloadevents", nil).WithContext(ctx)
+		lr.ServeHTTP(httptest.NewRecorder(), req)
+		lr.ReloadFiles("style.css")
+
+		want := livereload.Stats{Reloads: 1, Injected: 1, Skipped: 1}
+		if got := lr.Stats(); got != want {
+			t.Errorf("incorrect stats; want %+v, got %+v", want, got)
+		}
+		if !slices.Equal(reloads, []string{"css:style.css"}) {
+			t.Errorf("incorrect reloads: %q", reloads)
+		}
+		if connects != 1 || disconnects != 1 {
+			t.Errorf("incorrect client callbacks; connects %d, disconnects %d", connects, disconnects)
+		}
+		if !strings.Contains(logs.String(), `reason="Content-Type image/png"`) {
+			t.Errorf("skipped injection not logged: %s", logs.String())
+		}
+
+		resp := httptest.NewRecorder()
+		lr.MetricsHandler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		for _, line := range []string{
+			"livereload_clients 0\n",
+			"livereload_reloads_total 1\n",
+			`livereload_injections_total{outcome="skipped"} 1` + "\n",
+		} {
+			if !strings.Contains(resp.Body.String(), line) {
+				t.Errorf("metrics missing %q: %s", line, resp.Body)
+			}
+		}
+	})
+
+	t.Run("inject-filter", func(t *testing.T) {
 		upstream := &handler{
 			Body:        content,
-			ContentType: "text/unknown",
+			ContentType: "text/html",
+		}
+		tests := []struct {
+			name    string
+			options []livereload.Option
+			path    string
+			dest    string
+			inject  bool
+		}{
+			{"document", nil, "/", "document", true},
+			{"fetch", nil, "/", "empty", false},
+			{"skip-path-prefix", []livereload.Option{livereload.WithSkipPaths("/api/")}, "/api/users", "", false},
+			{"skip-path-glob", []livereload.Option{livereload.WithSkipPaths("/partials/*.html")}, "/partials/row.html", "", false},
+			{"skip-path-other", []livereload.Option{livereload.WithSkipPaths("/api/")}, "/apidocs", "", true},
+			{"filter", []livereload.Option{livereload.WithInjectFilter(func(req *http.Request) bool {
+				return req.Header.Get("HX-Request") == ""
+			})}, "/", "empty", true},
+		}
+		for _, test := range tests {
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.dest != "" {
+				req.Header.Set("Sec-Fetch-Dest", test.dest)
+			}
+			livereload.New(upstream, test.options...).ServeHTTP(resp, req)
+			body := resp.Body.Bytes()
+			if !bytes.Contains(body, content) {
+				t.Errorf("%s: response does not contain the expected body", test.name)
+			}
+			if bytes.Contains(body, script) != test.inject {
+				t.Errorf("%s: incorrect injection; want %t", test.name, test.inject)
+			}
+		}
+	})
+
+	t.Run("html-transform", func(t *testing.T) {
+		upstream := &handler{
+			Body:        []byte(`<script src="https://analytics.example.com/a.js"></script><p>html body</p>`),
+			ContentType: "text/html",
 		}
 		resp := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodGet, "/", nil)
 		if err != nil {
 			t.Fatalf("could not create request: %s", err)
 		}
-		livereload.New(upstream).ServeHTTP(resp, req)
+		option := livereload.WithHTMLTransform(func(b []byte) ([]byte, error) {
+			sel := htmlpatch.Selector{Tag: "script", Attr: "src", Value: "analytics"}
+			return htmlpatch.RemoveNodes(b, sel)
+		})
+		livereload.New(upstream, option).ServeHTTP(resp, req)
 		body, _ := io.ReadAll(resp.Result().Body)
-		if !bytes.Equal(body, content) {
-			t.Errorf("response of unknown type is modified")
+		if !bytes.Contains(body, htmlContent) {
+			t.Errorf("response does not contain the expected body")
+		}
+		if bytes.Contains(body, []byte("analytics")) {
+			t.Errorf("response contains the removed script")
+		}
+		if !bytes.Contains(body, script) {
+			t.Errorf("response does not contain the event listener script")
 		}
 	})
 
-	t.Run("content-disposition-attachment", func(t *testing.T) {
+	t.Run("request-rewrite", func(t *testing.T) {
+		var got string
+		upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				got = r.Header.Get("X-Debug")
+			}
+			w.Write(htmlContent)
+		})
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		option := livereload.WithRequestRewrite(func(r *http.Request) {
+			r.Header.Set("X-Debug", "abc")
+		})
+		livereload.New(upstream, option).ServeHTTP(resp, req)
+		if got != "abc" {
+			t.Errorf("upstream request is not rewritten")
+		}
+		if req.Header.Get("X-Debug") != "" {
+			t.Errorf("original request is modified")
+		}
+	})
+
+	t.Run("response-header", func(t *testing.T) {
+		for _, body := range [][]byte{htmlContent, []byte("\x00binary")} {
+			upstream := &handler{
+				Body: body,
+			}
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatalf("could not create request: %s", err)
+			}
+			option := livereload.WithResponseHeader(func(h http.Header) {
+				h.Set("Cross-Origin-Opener-Policy", "same-origin")
+			})
+			livereload.New(upstream, option).ServeHTTP(resp, req)
+			if resp.Header().Get("Cross-Origin-Opener-Policy") != "same-origin" {
+				t.Errorf("response header is not modified")
+			}
+		}
+	})
+
+	t.Run("base-href", func(t *testing.T) {
 		upstream := &handler{
-			Body:               content,
-			ContentType:        "text/html",
-			ContentDisposition: "attachment",
+			Body:        []byte(`<link rel="stylesheet" href="style.css"><p>html body</p>`),
+			ContentType: "text/html",
 		}
 		resp := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodGet, "/", nil)
 		if err != nil {
 			t.Fatalf("could not create request: %s", err)
 		}
-		livereload.New(upstream).ServeHTTP(resp, req)
+		livereload.New(upstream, livereload.WithBaseHref("/app/")).ServeHTTP(resp, req)
 		body, _ := io.ReadAll(resp.Result().Body)
-		if !bytes.Equal(body, content) {
-			t.Errorf("response of unknown type is modified")
+		if !bytes.Contains(body, []byte(`<head><base href="/app/"/><link rel="stylesheet" href="style.css"/>`)) {
+			t.Errorf("response does not contain the base tag before the stylesheet: %s", body)
+		}
+		if !bytes.Contains(body, script) {
+			t.Errorf("response does not contain the event listener script")
 		}
 	})
 
-	t.Run("bad-request", func(t *testing.T) {
+	t.Run("noscript-refresh", func(t *testing.T) {
 		upstream := &handler{
-			Body: content,
+			Body:        htmlContent,
+			ContentType: "text/html",
 		}
 		resp := httptest.NewRecorder()
-		req, err := http.NewRequest(http.MethodPut, "/livereloadevents", nil)
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
 		if err != nil {
 			t.Fatalf("could not create request: %s", err)
 		}
-		livereload.New(upstream).ServeHTTP(resp, req)
+		option := livereload.WithNoscriptRefresh(1500 * time.Millisecond)
+		livereload.New(upstream, option).ServeHTTP(resp, req)
 		body, _ := io.ReadAll(resp.Result().Body)
-		if !bytes.Contains(body, []byte("method not allowed")) {
-			t.Errorf("incorrect response body")
+		if !bytes.Contains(body, []byte(`<noscript><meta http-equiv="refresh" content="2"></noscript>`)) {
+			t.Errorf("response does not contain the refresh fallback: %s", body)
 		}
-		if resp.Code != http.StatusMethodNotAllowed {
-			t.Errorf("incorrect response status code")
+		if !bytes.Contains(body, script) {
+			t.Errorf("response does not contain the event listener script")
 		}
 	})
 
-	t.Run("no-reload-event", func(t *testing.T) {
+	t.Run("inject-html", func(t *testing.T) {
 		upstream := &handler{
-			Body: content,
+			Body:        []byte(`<p>html body</p>`),
+			ContentType: "text/html",
 		}
 		resp := httptest.NewRecorder()
-		ctx, cancel := context.WithCancel(context.Background())
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
 		if err != nil {
 			t.Fatalf("could not create request: %s", err)
 		}
-		lr := livereload.New(upstream)
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-			cancel()
-		}()
-		lr.ServeHTTP(resp, req)
+		livereload.New(upstream,
+			livereload.WithInjectHTML(htmlpatch.HeadEnd, `<meta name="robots" content="noindex">`),
+			livereload.WithInjectHTML(htmlpatch.BodyEnd, `<div id="toolbar"></div>`),
+		).ServeHTTP(resp, req)
 		body, _ := io.ReadAll(resp.Result().Body)
-		if len(body) != 0 {
-			t.Errorf("got event where none was expected")
+		if !bytes.Contains(body, []byte(`<meta name="robots" content="noindex"/>`)) {
+			t.Errorf("response does not contain the head snippet: %s", body)
+		}
+		if !bytes.Contains(body, []byte(`<p>html body</p><div id="toolbar"></div></body>`)) {
+			t.Errorf("response does not contain the body snippet: %s", body)
+		}
+		if !bytes.Contains(body, script) {
+			t.Errorf("response does not contain the event listener script")
 		}
 	})
 
-	t.Run("reload-event", func(t *testing.T) {
+	t.Run("toolbar", func(t *testing.T) {
 		upstream := &handler{
-			Body: content,
+			Body:        htmlContent,
+			ContentType: "text/html",
 		}
 		resp := httptest.NewRecorder()
-		ctx, cancel := context.WithCancel(context.Background())
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
 		if err != nil {
 			t.Fatalf("could not create request: %s", err)
 		}
-		lr := livereload.New(upstream)
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-			lr.Reload()
-			time.Sleep(100 * time.Millisecond)
-			cancel()
-		}()
-		lr.ServeHTTP(resp, req)
+		livereload.New(upstream, livereload.WithToolbar(true)).ServeHTTP(resp, req)
 		body, _ := io.ReadAll(resp.Result().Body)
-		if !bytes.Contains(body, []byte("event: message\ndata: reload\n")) {
-			t.Errorf("response does not contain the reload event")
+		if !bytes.Contains(body, []byte(`"toolbar":true`)) {
+			t.Errorf("response does not contain the event listener script config")
 		}
 	})
 
-	t.Run("reload-event-post-request", func(t *testing.T) {
+	t.Run("svg-document", func(t *testing.T) {
+		svg := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><path d="M0"/></svg>`)
 		upstream := &handler{
-			Body: content,
+			Body:        svg,
+			ContentType: "text/html",
 		}
 		resp := httptest.NewRecorder()
-		ctx, cancel := context.WithCancel(context.Background())
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
 		if err != nil {
 			t.Fatalf("could not create request: %s", err)
 		}
-		lr := livereload.New(upstream)
+		livereload.New(upstream).ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Equal(body, svg) {
+			t.Errorf("response of svg document is modified")
+		}
+	})
+
+	t.Run("xhtml-as-html", func(t *testing.T) {
+		doc := `<?xml version="1.0"?><!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">` +
+			`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>t</title></head><body></body></html>`
+		upstream := &handler{
+			Body:        []byte(doc),
+			ContentType: "text/html",
+		}
+		resp := httptest.NewRecorder()
+		livereload.New(upstream).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		body := resp.Body.String()
+		if !strings.HasPrefix(body, doc[:strings.Index(doc, "<title>")]) || !strings.Contains(body, "<script") {
+			t.Errorf("script not inserted into XHTML served as HTML: %q", body)
+		}
+	})
+
+	t.Run("charset", func(t *testing.T) {
+		encode := func(enc encoding.Encoding, s string) []byte {
+			b, err := enc.NewEncoder().Bytes([]byte(s))
+			if err != nil {
+				t.Fatalf("could not encode: %s", err)
+			}
+			return b
+		}
+		tests := []struct {
+			name        string
+			contentType string
+			enc         encoding.Encoding
+			doc         string
+		}{
+			{"content-type", "text/html; charset=Shift_JIS", japanese.ShiftJIS, `<html><head></head><body><p>こんにちは</p></body></html>`},
+			{"meta", "text/html", charmap.ISO8859_1, `<html><head><meta charset="iso-8859-1"></head><body><p>café</p></body></html>`},
+			{"utf-8", "text/html", encoding.Nop, `<html><head></head><body><p>café</p></body></html>`},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+					resp.Header().Set("Content-Type", test.contentType)
+					resp.Write(encode(test.enc, test.doc))
+				})
+				resp := httptest.NewRecorder()
+				livereload.New(upstream).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+				body, err := test.enc.NewDecoder().Bytes(resp.Body.Bytes())
+				if err != nil {
+					t.Fatalf("could not decode response: %s", err)
+				}
+				wantText := test.doc[strings.Index(test.doc, "<p>"):strings.Index(test.doc, "</p>")]
+				if !bytes.Contains(body, []byte(wantText)) {
+					t.Errorf("text not preserved; want %q in %q", wantText, body)
+				}
+				if !bytes.Contains(body, []byte("<script>")) {
+					t.Errorf("script not injected: %q", body)
+				}
+			})
+		}
+	})
+
+	t.Run("charset-xml-passthrough", func(t *testing.T) {
+		doc := "<?xml version=\"1.0\"?><svg xmlns=\"http://www.w3.org/2000/svg\"><title>caf\xe9</title></svg>"
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+			resp.Write([]byte(doc))
+		})
+		resp := httptest.NewRecorder()
+		livereload.New(upstream).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := resp.Body.String(); got != doc {
+			t.Errorf("XML document not passed through in its encoding; want %q, got %q", doc, got)
+		}
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		lr := livereload.New(http.NotFoundHandler())
+		lr.Publish("theme", "dark")
+		resp := httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil))
+		want := `{"seq":1,"type":"theme","data":"dark"}`
+		if body := resp.Body.String(); !strings.Contains(body, want) {
+			t.Errorf("event not published; want %s in %s", want, body)
+		}
+		if !strings.Contains(lr.Script(), "window.livereload.on = function") {
+			t.Errorf("script doesn't register window.livereload.on")
+		}
+		if !strings.Contains(lr.Script(), "window.livereload.queue") {
+			t.Errorf("script doesn't register the functions queued in window.livereload.queue")
+		}
+	})
+
+	t.Run("boot-id", func(t *testing.T) {
+		bootID := func(lr *livereload.Handler) string {
+			m := regexp.MustCompile(`"boot":"([0-9a-f]+)"`).FindStringSubmatch(lr.Script())
+			if m == nil {
+				t.Fatalf("boot ID not in script: %q", lr.Script())
+			}
+			return m[1]
+		}
+		lr := livereload.New(http.NotFoundHandler())
+		id := bootID(lr)
+		if other := bootID(livereload.New(http.NotFoundHandler())); other == id {
+			t.Errorf("handlers share the boot ID %q", id)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		resp := httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereloadevents", nil).WithContext(ctx))
+		want := "event: boot\ndata: " + id + "\n"
+		if body := resp.Body.String(); !strings.Contains(body, want) {
+			t.Errorf("boot ID not sent upon connecting; want %q in %q", want, body)
+		}
+		resp = httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil))
+		want = `"boot":"` + id + `"`
+		if body := resp.Body.String(); !strings.Contains(body, want) {
+			t.Errorf("boot ID not in polled events; want %s in %s", want, body)
+		}
+	})
+
+	t.Run("base-path", func(t *testing.T) {
+		lr := livereload.New(http.NotFoundHandler(), livereload.WithBasePath("/app/"))
+		if want := `"url":"/app/livereloadevents"`; !strings.Contains(lr.Script(), want) {
+			t.Errorf("event URL not prefixed; want %s in %q", want, lr.Script())
+		}
+		for _, path := range []string{"/app/livereloadevents", "/livereloadevents"} {
+			resp := httptest.NewRecorder()
+			lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path+"?since=0", nil))
+			if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"seq"`) {
+				t.Errorf("%s: event path not served: %d %q", path, resp.Code, resp.Body.String())
+			}
+		}
+		resp := httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/application/livereloadevents?since=0", nil))
+		if resp.Code != http.StatusNotFound {
+			t.Errorf("path with a longer prefix served as the event path: %d", resp.Code)
+		}
+	})
+
+	t.Run("cors-origins", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			origins []string
+			origin  string
+			want    string
+		}{
+			{"allowed", []string{"http://localhost:3000"}, "http://localhost:3000", "http://localhost:3000"},
+			{"not-allowed", []string{"http://localhost:3000"}, "http://localhost:4000", ""},
+			{"wildcard", []string{"*"}, "http://localhost:4000", "*"},
+			{"none", nil, "http://localhost:3000", ""},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				lr := livereload.New(http.NotFoundHandler(), livereload.WithCORSOrigins(test.origins...))
+
+				req := httptest.NewRequest(http.MethodOptions, "/livereloadevents", nil)
+				req.Header.Set("Origin", test.origin)
+				req.Header.Set("Access-Control-Request-Method", "GET")
+				req.Header.Set("Access-Control-Request-Headers", "last-event-id")
+				resp := httptest.NewRecorder()
+				lr.ServeHTTP(resp, req)
+				if resp.Code != http.StatusNoContent {
+					t.Errorf("preflight: got status %d, want %d", resp.Code, http.StatusNoContent)
+				}
+				if got := resp.Header().Get("Access-Control-Allow-Origin"); got != test.want {
+					t.Errorf("preflight: got allowed origin %q, want %q", got, test.want)
+				}
+				if got := resp.Header().Get("Access-Control-Allow-Headers"); test.want != "" && got != "last-event-id" {
+					t.Errorf("preflight: got allowed headers %q, want %q", got, "last-event-id")
+				}
+
+				req = httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil)
+				req.Header.Set("Origin", test.origin)
+				resp = httptest.NewRecorder()
+				lr.ServeHTTP(resp, req)
+				if got := resp.Header().Get("Access-Control-Allow-Origin"); got != test.want {
+					t.Errorf("got allowed origin %q, want %q", got, test.want)
+				}
+			})
+		}
+	})
+
+	t.Run("reload-error", func(t *testing.T) {
+		lr := livereload.New(http.NotFoundHandler())
+		connect := func() string {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/livereloadevents", nil).WithContext(ctx)
+			lr.ServeHTTP(resp, req)
+			return resp.Body.String()
+		}
+		lr.ReloadError("build failed:\nmain.go:1: syntax error")
+		want := "event: build-error\ndata: build failed:\ndata: main.go:1: syntax error\n"
+		if body := connect(); !strings.Contains(body, want) {
+			t.Errorf("error not sent to the connecting webpage; want %q in %q", want, body)
+		}
+		lr.Reload()
+		if body := connect(); strings.Contains(body, "build-error") {
+			t.Errorf("error not cleared by reloading: %q", body)
+		}
+	})
+
+	t.Run("reload-error-in-place", func(t *testing.T) {
+		lr := livereload.New(http.NotFoundHandler())
+		lr.ReloadError("build failed")
+		lr.ReloadCSS()
+		resp := httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil))
+		want := `{"seq":2,"type":"build-error","data":""}`
+		if body := resp.Body.String(); !strings.Contains(body, want) {
+			t.Errorf("overlay not hidden by reloading stylesheets; want %s in %s", want, body)
+		}
+	})
+
+	t.Run("preserve-markup", func(t *testing.T) {
+		doc := "<!doctype html>\n<html lang=en>\n<head>\n  <link rel=stylesheet href='a.css' />\n</head>\n<body><br/><img src=x alt=''></body>\n</html>\n"
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "text/html")
+			resp.Write([]byte(doc))
+		})
+		lr := livereload.New(upstream, livereload.WithPreserveMarkup(true))
+		resp := httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		body := resp.Body.String()
+		i := strings.Index(body, "<script>")
+		j := strings.Index(body, "</script>")
+		if i < 0 || j < 0 {
+			t.Fatalf("script not injected: %q", body)
+		}
+		if got := body[:i] + body[j+len("</script>"):]; got != doc {
+			t.Errorf("markup not preserved; want %q, got %q", doc, got)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		lr := livereload.New(http.NotFoundHandler())
+		connected := make(chan struct{})
+		done := make(chan struct{})
+		resp := httptest.NewRecorder()
 		go func() {
-			postReq, _ := http.NewRequest(http.MethodPost, "/livereloadevents", nil)
-			time.Sleep(100 * time.Millisecond)
-			lr.ServeHTTP(httptest.NewRecorder(), postReq)
-			time.Sleep(100 * time.Millisecond)
-			cancel()
+			defer close(done)
+			lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereloadevents", nil))
 		}()
+		go func() {
+			for lr.Stats().Clients == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			close(connected)
+		}()
+		<-connected
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := lr.Close(ctx); err != nil {
+			t.Fatalf("could not close: %s", err)
+		}
+		<-done
+		if body := resp.Body.String(); !strings.Contains(body, "event: server-closing\n") {
+			t.Errorf("server-closing event not sent: %q", body)
+		}
+
+		// Later connections are directed to reconnect right away.
+		resp = httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereloadevents", nil))
+		if body := resp.Body.String(); !strings.HasPrefix(body, "retry: 1000\nevent: server-closing\n") {
+			t.Errorf("incorrect response after closing: %q", body)
+		}
+	})
+
+	t.Run("external-script", func(t *testing.T) {
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "text/html")
+			resp.Header().Set("Content-Security-Policy", "script-src 'self' 'nonce-abc'")
+			resp.Write(content)
+		})
+		lr := livereload.New(upstream, livereload.WithExternalScript("/livereload.js"))
+
+		resp := httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		want := `<script nonce="abc" src="/livereload.js"></script>`
+		if body := resp.Body.String(); !strings.Contains(body, want) {
+			t.Errorf("script tag not injected; want %q in %q", want, body)
+		}
+
+		resp = httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereload.js", nil))
+		if got := resp.Header().Get("Content-Type"); got != "text/javascript; charset=utf-8" {
+			t.Errorf("incorrect Content-Type: %q", got)
+		}
+		if resp.Body.String() != lr.Script() {
+			t.Errorf("incorrect script: %q", resp.Body.String())
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/livereload.js", nil)
+		req.Header.Set("If-None-Match", resp.Header().Get("ETag"))
+		resp = httptest.NewRecorder()
 		lr.ServeHTTP(resp, req)
-		body, _ := io.ReadAll(resp.Result().Body)
-		if !bytes.Contains(body, []byte("event: message\ndata: reload\n")) {
-			t.Errorf("response does not contain the reload event")
+		if resp.Code != http.StatusNotModified {
+			t.Errorf("incorrect status for a revalidation; want %d, got %d", http.StatusNotModified, resp.Code)
 		}
 	})
 
-	t.Run("reload-event-custom-path", func(t *testing.T) {
-		eventPath := "/myEventPath"
+	t.Run("xhtml", func(t *testing.T) {
+		doc := `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>t</title></head><body/></html>`
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "application/xhtml+xml")
+			resp.Write([]byte(doc))
+		})
+		resp := httptest.NewRecorder()
+		livereload.New(upstream).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		body := resp.Body.String()
+		if !strings.HasPrefix(body, `<?xml version="1.0"?>`) || !strings.Contains(body, "<script>//<![CDATA[") || !strings.HasSuffix(body, "</head><body/></html>") {
+			t.Errorf("script not inserted as XML: %q", body)
+		}
+	})
+
+	t.Run("compressed-upstream", func(t *testing.T) {
+		compress := func(encoding string, b []byte) []byte {
+			var buf bytes.Buffer
+			var w io.WriteCloser
+			switch encoding {
+			case "gzip":
+				w = gzip.NewWriter(&buf)
+			case "br":
+				w = brotli.NewWriter(&buf)
+			case "zstd":
+				w, _ = zstd.NewWriter(&buf)
+			}
+			w.Write(b)
+			w.Close()
+			return buf.Bytes()
+		}
+		tests := []struct {
+			encoding string
+			body     []byte
+			inject   bool
+		}{
+			{"gzip", compress("gzip", content), true},
+			{"br", compress("br", content), true},
+			{"zstd", compress("zstd", content), true},
+			{"gzip", []byte("corrupt"), false},
+			{"gzip", compress("gzip", make([]byte, 65<<20)), false},
+			{"compress", []byte("unsupported"), false},
+		}
+		for _, test := range tests {
+			upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				if got := req.Header.Get("Accept-Encoding"); req.URL.Path == "/" && got != "identity" {
+					t.Errorf("incorrect Accept-Encoding; want identity, got %q", got)
+				}
+				resp.Header().Set("Content-Type", "text/html")
+				resp.Header().Set("Content-Encoding", test.encoding)
+				resp.Write(test.body)
+			})
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip, br, zstd")
+			livereload.New(upstream).ServeHTTP(resp, req)
+			body := resp.Body.Bytes()
+			encoding := resp.Header().Get("Content-Encoding")
+			if !test.inject {
+				if encoding != test.encoding || !bytes.Equal(body, test.body) {
+					t.Errorf("%s: response modified: %s %q", test.encoding, encoding, body[:min(len(body), 64)])
+				}
+				continue
+			}
+			if encoding != "" {
+				t.Errorf("%s: incorrect Content-Encoding; want none, got %q", test.encoding, encoding)
+			}
+			if !bytes.Contains(body, content) || !bytes.Contains(body, []byte("<script>")) {
+				t.Errorf("%s: script not injected into the decoded response: %q", test.encoding, body)
+			}
+		}
+	})
+
+	t.Run("content-type-other", func(t *testing.T) {
 		upstream := &handler{
-			Body: content,
+			Body:        content,
+			ContentType: "text/unknown",
 		}
 		resp := httptest.NewRecorder()
-		ctx, cancel := context.WithCancel(context.Background())
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, eventPath, nil)
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
 		if err != nil {
 			t.Fatalf("could not create request: %s", err)
 		}
-		option := livereload.WithEventPath(eventPath)
-		lr := livereload.New(upstream, option)
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-			lr.Reload()
-			time.Sleep(100 * time.Millisecond)
-			cancel()
-		}()
-		lr.ServeHTTP(resp, req)
+		livereload.New(upstream).ServeHTTP(resp, req)
 		body, _ := io.ReadAll(resp.Result().Body)
-		if !bytes.Contains(body, []byte("event: message\ndata: reload\n")) {
-			t.Errorf("response does not contain the reload event")
+		if !bytes.Equal(body, content) {
+			t.Errorf("response of unknown type is modified")
 		}
 	})
-}
 
-type handler struct {
-	Body               []byte
-	ContentType        string
-	ContentDisposition string
+	t.Run("passthrough-status", func(t *testing.T) {
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "image/png")
+			resp.WriteHeader(http.StatusNotFound)
+		})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/missing.png", nil)
+		livereload.New(upstream).ServeHTTP(resp, req)
+		if resp.Code != http.StatusNotFound {
+			t.Errorf("incorrect status; want %d, got %d", http.StatusNotFound, resp.Code)
+		}
+	})
+
+	t.Run("content-disposition-attachment", func(t *testing.T) {
+		upstream := &handler{
+			Body:               content,
+			ContentType:        "text/html",
+			ContentDisposition: "attachment",
+		}
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		livereload.New(upstream).ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Equal(body, content) {
+			t.Errorf("response of unknown type is modified")
+		}
+	})
+
+	t.Run("wasm", func(t *testing.T) {
+		wasm := []byte("\x00asm\x01\x00\x00\x00")
+		upstream := &handler{
+			Body:        wasm,
+			ContentType: "application/octet-stream",
+		}
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/main.wasm", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		option := livereload.WithDisableCaching(false)
+		livereload.New(upstream, option).ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Equal(body, wasm) {
+			t.Errorf("response of wasm type is modified")
+		}
+		if resp.Header().Get("Content-Type") != "application/wasm" {
+			t.Errorf("incorrect Content-Type header")
+		}
+		if resp.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("incorrect Cache-Control header")
+		}
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		lr := livereload.New(
+			upstream,
+			livereload.WithEventURL("http://events.localhost/livereloadevents"),
+			livereload.WithCredentials(true),
+			livereload.WithCORSOrigins("http://app.localhost", "*"),
+		)
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte(`"url":"http://events.localhost/livereloadevents","credentials":true`)) {
+			t.Errorf("response does not contain the event listener script config")
+		}
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest(http.MethodPost, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		req.Header.Set("Origin", "http://app.localhost")
+		lr.ServeHTTP(resp, req)
+		if resp.Header().Get("Access-Control-Allow-Origin") != "http://app.localhost" {
+			t.Errorf("incorrect Access-Control-Allow-Origin header")
+		}
+		if resp.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("incorrect Access-Control-Allow-Credentials header")
+		}
+
+		// Credentials are only allowed from the listed origins, despite "*".
+		resp = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil)
+		req.Header.Set("Origin", "http://evil.example")
+		lr.ServeHTTP(resp, req)
+		if got := resp.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("unlisted origin allowed with credentials: %q", got)
+		}
+		if got := resp.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("credentials allowed for unlisted origin: %q", got)
+		}
+	})
+
+	t.Run("csrf", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		tests := []struct {
+			name    string
+			header  http.Header
+			options []livereload.Option
+			target  string
+			code    int
+		}{
+			{"no-headers", nil, nil, "/livereloadevents", http.StatusOK},
+			{"same-origin", http.Header{"Sec-Fetch-Site": {"same-origin"}}, nil, "/livereloadevents", http.StatusOK},
+			{"cross-site", http.Header{"Sec-Fetch-Site": {"cross-site"}}, nil, "/livereloadevents", http.StatusForbidden},
+			{"same-site", http.Header{"Sec-Fetch-Site": {"same-site"}}, nil, "/livereloadevents", http.StatusForbidden},
+			{"origin-match", http.Header{"Origin": {"http://example.com"}}, nil, "/livereloadevents", http.StatusOK},
+			{"origin-mismatch", http.Header{"Origin": {"http://evil.com"}}, nil, "/livereloadevents", http.StatusForbidden},
+			{
+				"trusted-origin",
+				http.Header{"Origin": {"http://app.com"}, "Sec-Fetch-Site": {"cross-site"}},
+				[]livereload.Option{livereload.WithTrustedOrigins("http://app.com")},
+				"/livereloadevents",
+				http.StatusOK,
+			},
+			{
+				"disabled",
+				http.Header{"Sec-Fetch-Site": {"cross-site"}},
+				[]livereload.Option{livereload.WithCSRFProtection(false)},
+				"/livereloadevents",
+				http.StatusOK,
+			},
+			{
+				"missing-token",
+				nil,
+				[]livereload.Option{livereload.WithTriggerToken("secret")},
+				"/livereloadevents",
+				http.StatusForbidden,
+			},
+			{
+				"token",
+				nil,
+				[]livereload.Option{livereload.WithTriggerToken("secret")},
+				"/livereloadevents?token=secret",
+				http.StatusOK,
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				resp := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, test.target, nil)
+				for key, values := range test.header {
+					req.Header[key] = values
+				}
+				livereload.New(upstream, test.options...).ServeHTTP(resp, req)
+				if resp.Code != test.code {
+					t.Errorf("incorrect response status code; want %d, got %d", test.code, resp.Code)
+				}
+			})
+		}
+	})
+
+	t.Run("accessors", func(t *testing.T) {
+		lr := livereload.New(http.NotFoundHandler(), livereload.WithRandomEventPath())
+		if !bytes.HasPrefix([]byte(lr.EventPath()), []byte("/livereload-")) {
+			t.Errorf("incorrect event path: %q", lr.EventPath())
+		}
+		if !bytes.Contains([]byte(lr.Script()), []byte(`"url":"`+lr.EventPath()+`"`)) {
+			t.Errorf("script doesn't connect to the event path: %q", lr.Script())
+		}
+
+		upstream := &handler{
+			ContentType: "text/html",
+			Body:        content,
+		}
+		lr = livereload.New(upstream)
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		lr.ServeHTTP(resp, req)
+		if !bytes.Contains(resp.Body.Bytes(), []byte(lr.Script())) {
+			t.Errorf("injected script differs from Script: %q", resp.Body)
+		}
+	})
+
+	t.Run("random-event-path", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		livereload.New(upstream, livereload.WithRandomEventPath()).ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte(`{"url":"/livereload-`)) {
+			t.Errorf("response does not contain the random event path")
+		}
+	})
+
+	t.Run("client-disconnect", func(t *testing.T) {
+		writeErr := make(chan error, 1)
+		upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				return
+			}
+			// Keep writing regardless of the request's context.
+			w.Header().Set("Content-Type", "text/html")
+			for {
+				_, err := w.Write(htmlContent)
+				if err != nil {
+					writeErr <- err
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		done := make(chan struct{})
+		go func() {
+			livereload.New(upstream).ServeHTTP(httptest.NewRecorder(), req)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("handler did not return after the client disconnected")
+		}
+		select {
+		case <-writeErr:
+		case <-time.After(time.Second):
+			t.Errorf("upstream writes did not fail after the client disconnected")
+		}
+	})
+
+	t.Run("upstream-timeout", func(t *testing.T) {
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "text/html")
+			resp.Write(htmlContent)
+			<-req.Context().Done()
+		})
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		option := livereload.WithUpstreamTimeout(100 * time.Millisecond)
+		livereload.New(upstream, option).ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if resp.Code != http.StatusGatewayTimeout {
+			t.Errorf("incorrect response status code")
+		}
+		if !bytes.Contains(body, []byte("Upstream timed out")) {
+			t.Errorf("response does not contain the error page")
+		}
+		if !bytes.Contains(body, script) {
+			t.Errorf("response does not contain the event listener script")
+		}
+	})
+
+	t.Run("request-id", func(t *testing.T) {
+		for _, id := range []string{"", "myrequest"} {
+			var got string
+			upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" {
+					got = r.Header.Get("X-Request-Id")
+				}
+				w.Write(htmlContent)
+			})
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatalf("could not create request: %s", err)
+			}
+			if id != "" {
+				req.Header.Set("X-Request-Id", id)
+			}
+			livereload.New(upstream).ServeHTTP(resp, req)
+			if got == "" || id != "" && got != id {
+				t.Errorf("incorrect upstream request ID %q", got)
+			}
+			if resp.Header().Get("X-Request-Id") != got {
+				t.Errorf("incorrect response request ID")
+			}
+		}
+	})
+
+	t.Run("on-inject", func(t *testing.T) {
+		tests := []struct {
+			contentType string
+			sniffed     bool
+		}{
+			{"text/html", false},
+			{"", true},
+		}
+		for _, test := range tests {
+			upstream := &handler{
+				Body:        htmlContent,
+				ContentType: test.contentType,
+			}
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatalf("could not create request: %s", err)
+			}
+			var stats *livereload.InjectStats
+			option := livereload.WithOnInject(func(r *http.Request, s livereload.InjectStats) {
+				stats = &s
+			})
+			livereload.New(upstream, option).ServeHTTP(resp, req)
+			if stats == nil {
+				t.Fatalf("inject callback is not called")
+			}
+			if stats.OriginalSize != len(htmlContent) {
+				t.Errorf("incorrect original size %d", stats.OriginalSize)
+			}
+			if stats.ModifiedSize != resp.Body.Len() {
+				t.Errorf("incorrect modified size %d", stats.ModifiedSize)
+			}
+			if stats.Sniffed != test.sniffed {
+				t.Errorf("incorrect sniffed %t", stats.Sniffed)
+			}
+		}
+	})
+
+	t.Run("script-nonce", func(t *testing.T) {
+		upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Security-Policy", "script-src 'nonce-fromcsp'")
+			w.Header().Set("X-Nonce", "fromheader")
+			w.Write(htmlContent)
+		})
+		tests := []struct {
+			name   string
+			option livereload.Option
+			want   string
+		}{
+			{"default", nil, `nonce="fromcsp"`},
+			{"custom", livereload.WithScriptNonce(func(r *http.Request, h http.Header) string {
+				return h.Get("X-Nonce")
+			}), `nonce="fromheader"`},
+		}
+		for _, test := range tests {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatalf("could not create request: %s", err)
+			}
+			var options []livereload.Option
+			if test.option != nil {
+				options = append(options, test.option)
+			}
+			livereload.New(upstream, options...).ServeHTTP(resp, req)
+			if !bytes.Contains(resp.Body.Bytes(), []byte(test.want)) {
+				t.Errorf("%s: response does not contain the script nonce", test.name)
+			}
+		}
+	})
+
+	t.Run("upstream-panic-page", func(t *testing.T) {
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			panic("oops")
+		})
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		req.Header.Set("Sec-Fetch-Dest", "document")
+		req.Header.Set("X-Request-Id", "myrequest")
+		livereload.New(upstream).ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if resp.Code != http.StatusInternalServerError {
+			t.Errorf("incorrect response status code")
+		}
+		if !bytes.Contains(body, []byte("Upstream panicked")) || !bytes.Contains(body, []byte("oops")) {
+			t.Errorf("response does not contain the error page")
+		}
+		if !bytes.Contains(body, []byte("myrequest")) {
+			t.Errorf("response does not contain the request ID")
+		}
+	})
+
+	t.Run("upstream-panic-overlay", func(t *testing.T) {
+		upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			panic("oops")
+		})
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr := livereload.New(upstream)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			fetchResp := httptest.NewRecorder()
+			fetchReq := httptest.NewRequest(http.MethodGet, "/api", nil)
+			fetchReq.Header.Set("Sec-Fetch-Dest", "empty")
+			lr.ServeHTTP(fetchResp, fetchReq)
+			if fetchResp.Code != http.StatusInternalServerError {
+				t.Errorf("incorrect response status code")
+			}
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("event: overlay\ndata: panic serving GET /api: oops\n")) {
+			t.Errorf("response does not contain the overlay event")
+		}
+	})
+
+	t.Run("allowed-clients", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		lr := livereload.New(
+			upstream,
+			livereload.WithAllowedClients(
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("::1/128"),
+			),
+		)
+		tests := []struct {
+			remoteAddr string
+			code       int
+		}{
+			{"10.1.2.3:1234", http.StatusOK},
+			{"[::1]:1234", http.StatusOK},
+			{"[::ffff:10.1.2.3]:1234", http.StatusOK},
+			{"192.168.1.1:1234", http.StatusForbidden},
+		}
+		for _, test := range tests {
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/livereloadevents", nil)
+			req.RemoteAddr = test.remoteAddr
+			lr.ServeHTTP(resp, req)
+			if resp.Code != test.code {
+				t.Errorf("incorrect response status code for %s; want %d, got %d", test.remoteAddr, test.code, resp.Code)
+			}
+		}
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.168.1.1:1234"
+		lr.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("disallowed client could not make requests to the upstream")
+		}
+	})
+
+	t.Run("bad-request", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPut, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		livereload.New(upstream).ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("method not allowed")) {
+			t.Errorf("incorrect response body")
+		}
+		if resp.Code != http.StatusMethodNotAllowed {
+			t.Errorf("incorrect response status code")
+		}
+	})
+
+	t.Run("no-reload-event", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr := livereload.New(upstream)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if bytes.Contains(body, []byte("data: reload")) {
+			t.Errorf("got event where none was expected")
+		}
+	})
+
+	t.Run("reload-event", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr := livereload.New(upstream)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			lr.Reload()
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("event: message\ndata: reload\n")) {
+			t.Errorf("response does not contain the reload event")
+		}
+	})
+
+	t.Run("reconnect-event", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/livereloadevents", nil)
+		lr := livereload.New(upstream)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			lr.Reconnect()
+		}()
+		// The connection is expected to end without canceling the request.
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("retry: 100\nevent: reconnect\n")) {
+			t.Errorf("response does not contain the reconnect event: %q", body)
+		}
+	})
+
+	t.Run("websocket", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		lr := livereload.New(upstream, livereload.WithTransport(livereload.TransportWebSocket))
+		if !strings.Contains(lr.Script(), `"transport":"websocket"`) {
+			t.Errorf("script missing the transport: %s", lr.Script())
+		}
+		srv := httptest.NewServer(lr)
+		defer srv.Close()
+		wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/livereloadevents"
+
+		_, err := websocket.Dial(wsURL, "", "http://evil.example")
+		if err == nil {
+			t.Errorf("cross-origin connection accepted")
+		}
+
+		lr.Reload()
+		ws, err := websocket.Dial(wsURL, "", srv.URL)
+		if err != nil {
+			t.Fatalf("could not connect: %s", err)
+		}
+		defer ws.Close()
+		ws.SetDeadline(time.Now().Add(5 * time.Second))
+
+		var ev struct {
+			Seq  uint64
+			Type string
+			Data string
+		}
+		if err := websocket.JSON.Receive(ws, &ev); err != nil {
+			t.Fatalf("could not receive the boot event: %s", err)
+		}
+		if ev.Type != "boot" || ev.Data == "" {
+			t.Errorf("incorrect boot event: %+v", ev)
+		}
+		if err := websocket.JSON.Receive(ws, &ev); err != nil {
+			t.Fatalf("could not receive the initial event: %s", err)
+		}
+		if ev.Seq != 1 || ev.Type != "message" || ev.Data != "ping" {
+			t.Errorf("incorrect initial event: %+v", ev)
+		}
+		lr.Reload()
+		if err := websocket.JSON.Receive(ws, &ev); err != nil {
+			t.Fatalf("could not receive the reload event: %s", err)
+		}
+		if ev.Seq != 2 || ev.Type != "message" || ev.Data != "reload" {
+			t.Errorf("incorrect reload event: %+v", ev)
+		}
+	})
+
+	t.Run("websocket-origins", func(t *testing.T) {
+		lr := livereload.New(http.NotFoundHandler(),
+			livereload.WithTransport(livereload.TransportWebSocket),
+			livereload.WithCredentials(true),
+			livereload.WithCORSOrigins("http://app.localhost"),
+		)
+		srv := httptest.NewServer(lr)
+		defer srv.Close()
+		wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/livereloadevents"
+		for origin, allowed := range map[string]bool{
+			"http://app.localhost": true,
+			"http://evil.example":  false,
+			srv.URL:                true,
+		} {
+			ws, err := websocket.Dial(wsURL, "", origin)
+			if err == nil {
+				ws.Close()
+			}
+			if (err == nil) != allowed {
+				t.Errorf("%s: got accepted %t, want %t", origin, err == nil, allowed)
+			}
+		}
+	})
+
+	t.Run("events-since", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		lr := livereload.New(upstream)
+		lr.Reload()
+		lr.ReloadFiles("static/style.css")
+
+		tests := []struct {
+			since    string
+			status   int
+			complete bool
+			events   []string
+		}{
+			{"0", http.StatusOK, true, []string{"message:reload", "css:static/style.css"}},
+			{"1", http.StatusOK, true, []string{"css:static/style.css"}},
+			{"2", http.StatusOK, true, nil},
+			{"5", http.StatusOK, false, []string{"message:reload", "css:static/style.css"}},
+			{"x", http.StatusBadRequest, false, nil},
+		}
+		for _, test := range tests {
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/livereloadevents?since="+test.since, nil)
+			lr.ServeHTTP(resp, req)
+			if resp.Code != test.status {
+				t.Fatalf("since %s: incorrect status; want %d, got %d", test.since, test.status, resp.Code)
+			}
+			if resp.Code != http.StatusOK {
+				continue
+			}
+			var res struct {
+				Seq      uint64
+				Complete bool
+				Events   []struct {
+					Seq  uint64
+					Type string
+					Data string
+				}
+			}
+			if err := json.Unmarshal(resp.Body.Bytes(), &res); err != nil {
+				t.Fatalf("since %s: could not decode response: %s", test.since, err)
+			}
+			if res.Seq != 2 || res.Complete != test.complete {
+				t.Errorf("since %s: incorrect seq or complete: %s", test.since, resp.Body)
+			}
+			var events []string
+			for _, ev := range res.Events {
+				events = append(events, ev.Type+":"+ev.Data)
+			}
+			if !slices.Equal(events, test.events) {
+				t.Errorf("since %s: incorrect events; want %q, got %q", test.since, test.events, events)
+			}
+		}
+	})
+
+	t.Run("reload-event-post-request", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr := livereload.New(upstream)
+		go func() {
+			postReq, _ := http.NewRequest(http.MethodPost, "/livereloadevents", nil)
+			time.Sleep(100 * time.Millisecond)
+			lr.ServeHTTP(httptest.NewRecorder(), postReq)
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("event: message\ndata: reload\n")) {
+			t.Errorf("response does not contain the reload event")
+		}
+	})
+
+	t.Run("ghost-event", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr := livereload.New(upstream, livereload.WithGhostMode(true))
+		go func() {
+			interaction := bytes.NewReader([]byte("{\n\"type\": \"click\"\n}"))
+			postReq, _ := http.NewRequest(http.MethodPost, "/livereloadevents/ghost", interaction)
+			time.Sleep(100 * time.Millisecond)
+			postResp := httptest.NewRecorder()
+			lr.ServeHTTP(postResp, postReq)
+			if postResp.Code != http.StatusNoContent {
+				t.Errorf("incorrect response status code")
+			}
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("event: ghost\ndata: {\"type\":\"click\"}\n")) {
+			t.Errorf("response does not contain the ghost event")
+		}
+	})
+
+	t.Run("event-path-collision", func(t *testing.T) {
+		upstream := http.NewServeMux()
+		upstream.Handle("/livereloadevents", &handler{Body: content})
+		lr := livereload.New(upstream)
+		lr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		time.Sleep(100 * time.Millisecond)
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("event: warning\n")) {
+			t.Errorf("response does not contain the warning event")
+		}
+	})
+
+	t.Run("reload-event-custom-path", func(t *testing.T) {
+		eventPath := "/myEventPath"
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, eventPath, nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		option := livereload.WithEventPath(eventPath)
+		lr := livereload.New(upstream, option)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			lr.Reload()
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("event: message\ndata: reload\n")) {
+			t.Errorf("response does not contain the reload event")
+		}
+	})
+
+	t.Run("reload-files-css", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr := livereload.New(upstream)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			lr.ReloadFiles("static/style.css", "static/logo.png")
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("event: css\ndata: static/style.css\n")) {
+			t.Errorf("response does not contain the css event")
+		}
+		if !bytes.Contains(body, []byte("event: image\ndata: static/logo.png\n")) {
+			t.Errorf("response does not contain the image event")
+		}
+		if bytes.Contains(body, []byte("data: reload\n")) {
+			t.Errorf("got reload event where none was expected")
+		}
+	})
+
+	t.Run("reload-css-asset-paths", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		lr := livereload.New(upstream)
+		lr.ReloadCSS()
+		lr.ReloadAsset("static/font.woff2")
+		lr.ReloadPaths("/docs/", "/index.html")
+		lr.ReloadPaths()
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil)
+		lr.ServeHTTP(resp, req)
+		var res struct {
+			Events []struct {
+				Type string
+				Data string
+			}
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &res); err != nil {
+			t.Fatalf("could not decode response: %s", err)
+		}
+		var events []string
+		for _, ev := range res.Events {
+			events = append(events, ev.Type+":"+ev.Data)
+		}
+		want := []string{"css:", "asset:static/font.woff2", "paths:/docs/\n/index.html", "message:reload"}
+		if !slices.Equal(events, want) {
+			t.Errorf("incorrect events; want %q, got %q", want, events)
+		}
+	})
+
+	t.Run("reload-files-module", func(t *testing.T) {
+		upstream := &handler{
+			Body: content,
+		}
+		lr := livereload.New(upstream, livereload.WithReloadKind(".js", livereload.ReloadModule))
+		lr.ReloadFiles("src/render.js", "static/style.css")
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil)
+		lr.ServeHTTP(resp, req)
+		if !bytes.Contains(resp.Body.Bytes(), []byte(`{"seq":1,"type":"module","data":"src/render.js"}`)) {
+			t.Errorf("response does not contain the module event: %q", resp.Body)
+		}
+		if bytes.Contains(resp.Body.Bytes(), []byte(`"data":"reload"`)) {
+			t.Errorf("got reload event where none was expected")
+		}
+	})
+
+	t.Run("reload-event-upstream-restart", func(t *testing.T) {
+		upstream := httptest.NewServer(&handler{Body: content})
+		addr := upstream.Listener.Addr().String()
+		u, _ := url.Parse(upstream.URL)
+		resp := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/livereloadevents", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %s", err)
+		}
+		lr := livereload.New(livereload.ReverseProxy(u))
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			upstream.Close()
+			time.Sleep(time.Second)
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				t.Errorf("could not listen: %s", err)
+				cancel()
+				return
+			}
+			restarted := httptest.NewUnstartedServer(&handler{Body: content})
+			restarted.Listener = l
+			restarted.Start()
+			defer restarted.Close()
+			time.Sleep(time.Second)
+			cancel()
+		}()
+		lr.ServeHTTP(resp, req)
+		body, _ := io.ReadAll(resp.Result().Body)
+		if !bytes.Contains(body, []byte("event: message\ndata: reload\n")) {
+			t.Errorf("response does not contain the reload event")
+		}
+	})
+}
+
+func TestReverseProxyClientCertificate(t *testing.T) {
+
+	content := []byte("<p>html body</p>")
+	upstream := httptest.NewUnstartedServer(&handler{Body: content})
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	// The server's own certificate is good enough as a client certificate,
+	// since the server doesn't verify client certificates.
+	u, _ := url.Parse(upstream.URL)
+	pool := x509.NewCertPool()
+	pool.AddCert(upstream.Certificate())
+	proxy := livereload.ReverseProxy(
+		u,
+		livereload.WithClientCertificate(upstream.TLS.Certificates[0]),
+		livereload.WithRootCAs(pool),
+	)
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatalf("could not create request: %s", err)
+	}
+	livereload.New(proxy).ServeHTTP(resp, req)
+	body, _ := io.ReadAll(resp.Result().Body)
+	if !bytes.Contains(body, content) {
+		t.Errorf("response does not contain the expected body: %q", body)
+	}
+}
+
+func TestUpstreamStreaming(t *testing.T) {
+
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("/ws", websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	mux.HandleFunc("/sse", func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(resp, "data: hello\n\n")
+		resp.(http.Flusher).Flush()
+		<-release
+	})
+	upstream := httptest.NewServer(mux)
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	srv := httptest.NewServer(livereload.New(livereload.ReverseProxy(u)))
+	defer srv.Close()
+	defer close(release)
+
+	t.Run("websocket", func(t *testing.T) {
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", "", srv.URL)
+		if err != nil {
+			t.Fatalf("could not connect through the proxy: %s", err)
+		}
+		defer ws.Close()
+		ws.SetDeadline(time.Now().Add(5 * time.Second))
+		websocket.Message.Send(ws, "ping")
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil || msg != "ping" {
+			t.Errorf("incorrect echo; want %q, got %q (%v)", "ping", msg, err)
+		}
+	})
+
+	t.Run("sse", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/sse")
+		if err != nil {
+			t.Fatalf("could not get: %s", err)
+		}
+		defer resp.Body.Close()
+		buf := make([]byte, len("data: hello\n\n"))
+		if _, err := io.ReadFull(resp.Body, buf); err != nil {
+			t.Fatalf("flushed event not received: %s", err)
+		}
+	})
+}
+
+func TestFileServer(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"page.html":    {Data: []byte("<p>hello</p>")},
+		"page.html.gz": {Data: []byte("gzipped html")},
+		"app.js":       {Data: []byte("console.log(1)")},
+		"app.js.gz":    {Data: []byte("gzipped js")},
+		"app.js.br":    {Data: []byte("brotli js")},
+		"style.css":    {Data: []byte("p{}")},
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		lr             bool
+		wantEncoding   string
+		wantBody       string
+	}{
+		{"br", "/app.js", "gzip, br", false, "br", "brotli js"},
+		{"gzip", "/app.js", "gzip", false, "gzip", "gzipped js"},
+		{"br-refused", "/app.js", "gzip, br;q=0", false, "gzip", "gzipped js"},
+		{"identity", "/app.js", "", false, "", "console.log(1)"},
+		{"no-sibling", "/style.css", "gzip, br", false, "", "p{}"},
+		{"html", "/page.html", "gzip", false, "gzip", "gzipped html"},
+		{"behind-handler", "/app.js", "gzip, br", true, "br", "brotli js"},
+		{"behind-handler-html", "/page.html", "gzip", true, "", "<p>hello</p>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var h http.Handler = livereload.FileServer(http.FS(fsys))
+			if test.lr {
+				h = livereload.New(h)
+			}
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			h.ServeHTTP(resp, req)
+			if got := resp.Header().Get("Content-Encoding"); got != test.wantEncoding {
+				t.Errorf("incorrect Content-Encoding; want %q, got %q", test.wantEncoding, got)
+			}
+			body := resp.Body.Bytes()
+			if !bytes.Contains(body, []byte(test.wantBody)) {
+				t.Errorf("incorrect body; want it to contain %q, got %q", test.wantBody, body)
+			}
+			if test.lr && test.wantEncoding != "" && bytes.Contains(body, []byte("<script")) {
+				t.Errorf("injected into a compressed response")
+			}
+		})
+	}
+}
+
+func TestVirtualHosts(t *testing.T) {
+
+	upstream := func(name string) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "text/html")
+			io.WriteString(resp, "<p>"+name+"</p>")
+		})
+	}
+	lr := livereload.New(livereload.VirtualHosts(map[string]http.Handler{
+		"api.localhost":      upstream("api"),
+		"*.app.localhost":    upstream("app"),
+		"*.eu.app.localhost": upstream("eu"),
+	}))
+
+	tests := []struct {
+		host   string
+		status int
+		want   string
+	}{
+		{"api.localhost:8090", http.StatusOK, "<p>api</p>"},
+		{"API.localhost", http.StatusOK, "<p>api</p>"},
+		{"foo.app.localhost", http.StatusOK, "<p>app</p>"},
+		{"foo.bar.app.localhost", http.StatusOK, "<p>app</p>"},
+		{"foo.eu.app.localhost", http.StatusOK, "<p>eu</p>"},
+		{"app.localhost", http.StatusNotFound, "no upstream"},
+		{"localhost", http.StatusNotFound, "no upstream"},
+	}
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = test.host
+			lr.ServeHTTP(resp, req)
+			if resp.Code != test.status {
+				t.Errorf("incorrect status; want %d, got %d", test.status, resp.Code)
+			}
+			if !bytes.Contains(resp.Body.Bytes(), []byte(test.want)) {
+				t.Errorf("response does not contain %q", test.want)
+			}
+			if test.status == http.StatusOK && !bytes.Contains(resp.Body.Bytes(), []byte("<script")) {
+				t.Errorf("script not injected")
+			}
+		})
+	}
+}
+
+func TestLiveReloadProtocol(t *testing.T) {
+
+	lr := livereload.New(&handler{Body: []byte("<p>hello</p>")})
+	srv := httptest.NewServer(lr.LiveReloadProtocol())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/livereload.js")
+	if err != nil {
+		t.Fatalf("could not get the script: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("incorrect status of the script; want 200, got %d", resp.StatusCode)
+	}
+
+	_, err = websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/livereload", "", "http://evil.example")
+	if err == nil {
+		t.Errorf("connection from another website accepted")
+	}
+
+	resp, err = http.Post(srv.URL+"/changed", "application/json",
+		strings.NewReader(`{"files":["`+strings.Repeat("a", 2<<20)+`"]}`))
+	if err != nil {
+		t.Fatalf("could not report changes: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("oversized body not rejected; got status %d", resp.StatusCode)
+	}
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/livereload", "", "chrome-extension://abc")
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+
+	type command struct {
+		Command   string
+		Protocols []string
+		Path      string
+		LiveCSS   bool
+		LiveImg   bool
+	}
+	websocket.JSON.Send(ws, command{
+		Command:   "hello",
+		Protocols: []string{"http://livereload.com/protocols/official-7"},
+	})
+	var cmd command
+	if err := websocket.JSON.Receive(ws, &cmd); err != nil {
+		t.Fatalf("could not receive hello: %s", err)
+	}
+	if cmd.Command != "hello" || !slices.Contains(cmd.Protocols, "http://livereload.com/protocols/official-7") {
+		t.Errorf("incorrect hello: %+v", cmd)
+	}
+
+	tests := []struct {
+		name    string
+		trigger func() error
+		want    command
+	}{
+		{
+			name: "changed-post",
+			trigger: func() error {
+				body := strings.NewReader(`{"files":["static/style.css"]}`)
+				resp, err := http.Post(srv.URL+"/changed", "application/json", body)
+				if err == nil {
+					resp.Body.Close()
+				}
+				return err
+			},
+			want: command{Command: "reload", Path: "static/style.css", LiveCSS: true},
+		},
+		{
+			name: "changed-get",
+			trigger: func() error {
+				resp, err := http.Get(srv.URL + "/changed?files=index.html")
+				if err == nil {
+					resp.Body.Close()
+				}
+				return err
+			},
+			want: command{Command: "reload"},
+		},
+		{
+			name: "reload-asset",
+			trigger: func() error {
+				lr.ReloadAsset("font.woff2")
+				return nil
+			},
+			want: command{Command: "reload", Path: "font.woff2", LiveCSS: true, LiveImg: true},
+		},
+	}
+	for _, test := range tests {
+		if err := test.trigger(); err != nil {
+			t.Fatalf("%s: could not trigger: %s", test.name, err)
+		}
+		var cmd command
+		if err := websocket.JSON.Receive(ws, &cmd); err != nil {
+			t.Fatalf("%s: could not receive: %s", test.name, err)
+		}
+		if !reflect.DeepEqual(cmd, test.want) {
+			t.Errorf("%s: incorrect command; want %+v, got %+v", test.name, test.want, cmd)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+
+	upstream := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		resp.Header().Set("Content-Type", "text/html")
+		resp.WriteHeader(http.StatusCreated)
+		io.WriteString(resp, "<p>"+string(body)+"</p>")
+	})
+	rec := livereload.NewRecorder(upstream, livereload.WithRecordBodies(true))
+	lr := livereload.New(rec)
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.localhost/form?a=1", bytes.NewReader([]byte("hello")))
+	req.Header.Set("Content-Type", "text/plain")
+	resp := httptest.NewRecorder()
+	lr.ServeHTTP(resp, req)
+	if !bytes.Contains(resp.Body.Bytes(), []byte("<p>hello</p>")) {
+		t.Fatalf("upstream did not receive the body: %q", resp.Body)
+	}
+
+	type har struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					Method      string
+					URL         string
+					QueryString []struct{ Name, Value string }
+					PostData    struct{ Text string }
+				}
+				Response struct {
+					Status  int
+					Content struct {
+						MimeType string
+						Text     string
+					}
+				}
+			}
+		}
+	}
+	decode := func(rec *livereload.Recorder) har {
+		buf := new(bytes.Buffer)
+		if err := rec.WriteHAR(buf); err != nil {
+			t.Fatalf("could not write HAR: %s", err)
+		}
+		var h har
+		if err := json.Unmarshal(buf.Bytes(), &h); err != nil {
+			t.Fatalf("could not decode HAR: %s", err)
+		}
+		return h
+	}
+
+	h := decode(rec)
+	if len(h.Log.Entries) != 1 {
+		t.Fatalf("incorrect entry count; want 1, got %d", len(h.Log.Entries))
+	}
+	e := h.Log.Entries[0]
+	if e.Request.Method != http.MethodPost ||
+		e.Request.URL != "http://example.localhost/form?a=1" ||
+		len(e.Request.QueryString) != 1 ||
+		e.Request.PostData.Text != "hello" {
+		t.Errorf("incorrect request: %+v", e.Request)
+	}
+	if e.Response.Status != http.StatusCreated ||
+		e.Response.Content.MimeType != "text/html" ||
+		e.Response.Content.Text != "<p>hello</p>" {
+		t.Errorf("incorrect response: %+v", e.Response)
+	}
+
+	other := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		io.WriteString(resp, "other "+string(body))
+	})
+	replay, err := rec.Replay(context.Background(), other)
+	if err != nil {
+		t.Fatalf("could not replay: %s", err)
+	}
+	h = decode(replay)
+	if len(h.Log.Entries) != 1 {
+		t.Fatalf("incorrect replayed entry count; want 1, got %d", len(h.Log.Entries))
+	}
+	e = h.Log.Entries[0]
+	if e.Response.Status != http.StatusOK || e.Response.Content.Text != "other hello" {
+		t.Errorf("incorrect replayed response: %+v", e.Response)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func(name, data string) {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("could not create directory: %s", err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+	write("static/style.css", "p{}")
+	write("node_modules/lib.css", "p{}")
+
+	lr := livereload.New(http.NotFoundHandler())
+	w := livereload.NewWatcher(lr,
+		livereload.WithPollInterval(10*time.Millisecond),
+		livereload.WithDebounce(50*time.Millisecond),
+		livereload.WithExclude("node_modules"),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx, dir)
+	time.Sleep(50 * time.Millisecond)
+
+	// Ignored changes.
+	write("node_modules/lib.css", "p{color:red}")
+	write("static/.style.css.swp", "x")
+	// Changes reloaded together.
+	write("static/style.css", "p{color:red}")
+	time.Sleep(20 * time.Millisecond)
+	write("static/logo.png", "png")
+	time.Sleep(200 * time.Millisecond)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil)
+	lr.ServeHTTP(resp, req)
+	var res struct {
+		Events []struct{ Type, Data string }
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &res); err != nil {
+		t.Fatalf("could not decode events: %s", err)
+	}
+	var events []string
+	for _, ev := range res.Events {
+		events = append(events, ev.Type+":"+ev.Data)
+	}
+	slices.Sort(events)
+	want := []string{"css:static/style.css", "image:static/logo.png"}
+	if !slices.Equal(events, want) {
+		t.Errorf("incorrect events; want %q, got %q", want, events)
+	}
+}
+
+func TestRunner(t *testing.T) {
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command is not available")
+	}
+
+	newHandler := func(options ...livereload.Option) (*livereload.Handler, <-chan struct{}) {
+		reloads := make(chan struct{}, 10)
+		lr := livereload.New(http.NotFoundHandler(), append(options,
+			livereload.WithOnReload(func(sse.Event) { reloads <- struct{}{} }),
+		)...)
+		return lr, reloads
+	}
+	expectReload := func(t *testing.T, reloads <-chan struct{}, want bool) {
+		t.Helper()
+		select {
+		case <-reloads:
+			if !want {
+				t.Errorf("unexpected reload")
+			}
+		case <-time.After(300 * time.Millisecond):
+			if want {
+				t.Errorf("expected a reload")
+			}
+		}
+	}
+
+	t.Run("waits-for-ready", func(t *testing.T) {
+		var isReady atomic.Bool
+		upstream := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if !isReady.Load() {
+				resp.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer upstream.Close()
+
+		lr, reloads := newHandler()
+		r := livereload.NewRunner(lr,
+			livereload.WithBuildCommand(goBin, "env", "GOOS"),
+			livereload.WithReadyURL(upstream.URL),
+			livereload.WithRunnerOutput(io.Discard, io.Discard),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go r.Run(ctx)
+
+		expectReload(t, reloads, false)
+		isReady.Store(true)
+		expectReload(t, reloads, true)
+
+		r.Trigger()
+		expectReload(t, reloads, true)
+	})
+
+	t.Run("build-failure", func(t *testing.T) {
+		lr, reloads := newHandler(livereload.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+		r := livereload.NewRunner(lr,
+			livereload.WithBuildCommand(goBin, "no-such-command"),
+			livereload.WithRunnerOutput(io.Discard, io.Discard),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go r.Run(ctx)
+		r.Trigger()
+		expectReload(t, reloads, false)
+
+		resp := httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil))
+		if !strings.Contains(resp.Body.String(), `"type":"build-error"`) {
+			t.Errorf("build failure not shown on the webpages: %s", resp.Body.String())
+		}
+	})
+}
+
+func TestReloadKindOf(t *testing.T) {
+	lr := livereload.New(
+		&handler{},
+		livereload.WithReloadKind(".SCSS", livereload.ReloadCSS),
+		livereload.WithReloadKind(".svg", livereload.ReloadPage),
+		livereload.WithReloadKind("less", livereload.ReloadCSS),
+	)
+	tests := []struct {
+		path string
+		kind livereload.ReloadKind
+	}{
+		{"style.css", livereload.ReloadCSS},
+		{"STYLE.CSS", livereload.ReloadCSS},
+		{"style.scss", livereload.ReloadCSS},
+		{"style.less", livereload.ReloadCSS},
+		{"img/logo.png", livereload.ReloadImage},
+		{"img/logo.svg", livereload.ReloadPage},
+		{"index.html", livereload.ReloadPage},
+		{"main", livereload.ReloadPage},
+	}
+	for _, test := range tests {
+		got := lr.ReloadKindOf(test.path)
+		if got != test.kind {
+			t.Errorf("incorrect reload kind of %q; want %d, got %d", test.path, test.kind, got)
+		}
+	}
+}
+
+func TestScript(t *testing.T) {
+
+	nodeBin, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("the node command is not available")
+	}
+
+	// run runs the script in a minimal stand-in for a browser,
+	// followed by the given JavaScript, which dispatches events
+	// using the event function, and returns the output.
+	run := func(t *testing.T, js string, options ...livereload.Option) string {
+		t.Helper()
+		const browser = `
+			globalThis.window = globalThis;
+			globalThis.addEventListener = function () {};
+			globalThis.EventSource = class extends EventTarget {
+				constructor() { super(); globalThis.source = this; }
+			};
+			globalThis.document = new EventTarget();
+			Object.assign(document, {
+				querySelector() { return null; },
+				querySelectorAll() { return []; },
+				getElementById() { return null; },
+			});
+			globalThis.location = { pathname: "/", href: "http://localhost/", reload() { console.log("reload"); } };
+			globalThis.fetch = function (url, init) {
+				if (init && init.method === "POST") {
+					console.log("post " + init.body);
+				}
+				return new Promise(function () {});
+			};
+			function event(type, data, id) {
+				source.dispatchEvent(new MessageEvent(type, { data: data, lastEventId: id }));
+			}
+			// input returns a stand-in for an input element with the given attributes.
+			function input(type, autocomplete) {
+				return {
+					tagName: "INPUT",
+					type: type,
+					value: "",
+					getAttribute(name) { return name === "autocomplete" ? autocomplete : null; },
+					dispatchEvent() {},
+				};
+			}
+			// type dispatches a trusted input event for el.
+			function type(el, value) {
+				el.value = value;
+				var ev = new Event("input");
+				Object.defineProperty(ev, "isTrusted", { value: true });
+				Object.defineProperty(ev, "target", { value: el });
+				document.dispatchEvent(ev);
+			}
+		`
+		path := filepath.Join(t.TempDir(), "script.js")
+		lr := livereload.New(http.NotFoundHandler(), options...)
+		err := os.WriteFile(path, []byte(browser+lr.Script()+js), 0o644)
+		if err != nil {
+			t.Fatalf("could not write the script: %s", err)
+		}
+		out, err := exec.Command(nodeBin, path).CombinedOutput()
+		if err != nil {
+			t.Fatalf("could not run the script: %s: %s", err, out)
+		}
+		return string(out)
+	}
+
+	t.Run("boot-after-numbered-event", func(t *testing.T) {
+		// EventSource gives the unnumbered boot event sent upon reconnecting
+		// the ID of the last numbered event.
+		out := run(t, `
+			event("css", "style.css", "3");
+			source.dispatchEvent(new Event("error"));
+			source.dispatchEvent(new Event("open"));
+			event("boot", "restarted", "3");
+		`)
+		if !strings.Contains(out, "reload") {
+			t.Errorf("not reloaded after reconnecting to a restarted server: %q", out)
+		}
+	})
+
+	t.Run("ghost-sensitive-input", func(t *testing.T) {
+		out := run(t, `
+			type(input("text", null), "name");
+			type(input("password", null), "password");
+			type(input("file", null), "C:\\fakepath\\id.png");
+			type(input("text", "billing cc-number"), "4242");
+			type(input("text", "one-time-code"), "123456");
+		`, livereload.WithGhostMode(true))
+		if !strings.Contains(out, `"value":"name"`) {
+			t.Errorf("input not mirrored: %q", out)
+		}
+		if n := strings.Count(out, "post "); n != 1 {
+			t.Errorf("sensitive input mirrored: %q", out)
+		}
+	})
+
+	t.Run("ghost-file-input", func(t *testing.T) {
+		out := run(t, `
+			var el = input("file", null);
+			Object.defineProperty(el, "value", {
+				set() { throw new Error("InvalidStateError"); },
+			});
+			document.querySelector = function () { return el; };
+			event("ghost", JSON.stringify({ id: "other", path: "/", type: "input", selector: "input", value: "x" }), "");
+			console.log("done");
+		`, livereload.WithGhostMode(true))
+		if !strings.Contains(out, "done") {
+			t.Errorf("mirroring into a file input failed: %q", out)
+		}
+	})
+
+	t.Run("replayed-event", func(t *testing.T) {
+		out := run(t, `
+			event("paths", "/", "3");
+			event("paths", "/", "2");
+		`)
+		if n := strings.Count(out, "reload"); n != 1 {
+			t.Errorf("incorrect number of reloads; want 1, got %d: %q", n, out)
+		}
+	})
+}
+
+type handler struct {
+	Body               []byte
+	ContentType        string
+	ContentDisposition string
 }
 
 func (h *handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
@@ -312,3 +2513,116 @@ func (h *handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	}
 	resp.Write(h.Body)
 }
+
+func TestReverseProxyOptions(t *testing.T) {
+
+	t.Run("rewrites", func(t *testing.T) {
+		var gotPath, gotHost string
+		upstream := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			gotPath, gotHost = req.URL.Path, req.Host
+		}))
+		defer upstream.Close()
+		u, _ := url.Parse(upstream.URL)
+
+		tests := []struct {
+			name     string
+			options  []livereload.ProxyOption
+			wantPath string
+			wantHost string
+		}{
+			{"default", nil, "/api/users", u.Host},
+			{"strip-prefix", []livereload.ProxyOption{livereload.WithStripPrefix("/api")}, "/users", u.Host},
+			{"preserve-host", []livereload.ProxyOption{livereload.WithPreserveHost(true)}, "/api/users", "example.com"},
+			{"host", []livereload.ProxyOption{livereload.WithPreserveHost(true), livereload.WithHost("other.test")}, "/api/users", "other.test"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/api/users", nil)
+				livereload.ReverseProxy(u, tt.options...).ServeHTTP(httptest.NewRecorder(), req)
+				if gotPath != tt.wantPath {
+					t.Errorf("upstream got path %q, want %q", gotPath, tt.wantPath)
+				}
+				if gotHost != tt.wantHost {
+					t.Errorf("upstream got host %q, want %q", gotHost, tt.wantHost)
+				}
+			})
+		}
+	})
+
+	t.Run("insecure-skip-verify", func(t *testing.T) {
+		content := []byte("<p>html body</p>")
+		upstream := httptest.NewTLSServer(&handler{Body: content})
+		defer upstream.Close()
+		u, _ := url.Parse(upstream.URL)
+
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		livereload.ReverseProxy(u, livereload.WithInsecureSkipVerify(true)).ServeHTTP(resp, req)
+		if body := resp.Body.Bytes(); !bytes.Contains(body, content) {
+			t.Errorf("response does not contain the expected body: %q", body)
+		}
+	})
+
+	t.Run("round-tripper", func(t *testing.T) {
+		u, _ := url.Parse("http://upstream.test")
+		rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusTeapot,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader("")),
+				Request:    req,
+			}, nil
+		})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		livereload.ReverseProxy(u, livereload.WithRoundTripper(rt)).ServeHTTP(resp, req)
+		if resp.Code != http.StatusTeapot {
+			t.Errorf("got status %d, want %d", resp.Code, http.StatusTeapot)
+		}
+	})
+
+	t.Run("error-page", func(t *testing.T) {
+		upstream := httptest.NewServer(http.NotFoundHandler())
+		u, _ := url.Parse(upstream.URL)
+		upstream.Close()
+		proxy := livereload.ReverseProxy(u, livereload.WithRetries(0, 0))
+
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Sec-Fetch-Mode", "navigate")
+		req.Header.Set("Accept", "text/html")
+		livereload.New(proxy).ServeHTTP(resp, req)
+		if resp.Code != http.StatusBadGateway {
+			t.Errorf("got status %d, want %d", resp.Code, http.StatusBadGateway)
+		}
+		body := resp.Body.String()
+		if !strings.Contains(body, "Waiting for the upstream") || !strings.Contains(body, "EventSource") {
+			t.Errorf("response is not the error page with the script: %q", body)
+		}
+	})
+
+	t.Run("error-handler", func(t *testing.T) {
+		upstream := httptest.NewServer(http.NotFoundHandler())
+		u, _ := url.Parse(upstream.URL)
+		upstream.Close()
+		var gotErr error
+		proxy := livereload.ReverseProxy(u,
+			livereload.WithRetries(0, 0),
+			livereload.WithErrorHandler(func(resp http.ResponseWriter, req *http.Request, err error) {
+				gotErr = err
+				resp.WriteHeader(http.StatusServiceUnavailable)
+			}),
+		)
+		resp := httptest.NewRecorder()
+		proxy.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		if gotErr == nil || resp.Code != http.StatusServiceUnavailable {
+			t.Errorf("error handler was not used: status %d, error %v", resp.Code, gotErr)
+		}
+	})
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
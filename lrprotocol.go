@@ -0,0 +1,226 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/koonix/go-livereload/sse"
+	"golang.org/x/net/websocket"
+)
+
+// LiveReloadPort is the port that the classic [LiveReload] servers listen on,
+// and that its browser extensions and editor plugins connect to.
+// See [Handler.LiveReloadProtocol].
+//
+// [LiveReload]: https://livereload.com
+const LiveReloadPort = 35729
+
+// lrProtocol is the version of the LiveReload protocol that's spoken.
+const lrProtocol = "http://livereload.com/protocols/official-7"
+
+//go:embed lrprotocol.js
+var lrScript string
+
+// LiveReloadProtocol returns an [http.Handler] that speaks
+// the classic [LiveReload protocol], for the tools that already do,
+// such as LiveReload browser extensions and editor plugins.
+// It's meant to be served at [LiveReloadPort]:
+//
+//	lr := livereload.New(upstream)
+//	go http.ListenAndServe("127.0.0.1:35729", lr.LiveReloadProtocol())
+//	http.ListenAndServe("127.0.0.1:8090", lr)
+//
+// It serves:
+//
+//   - "/livereload": the WebSocket endpoint the browser extensions connect to,
+//     which is sent the reloads of the Handler.
+//   - "/livereload.js": a script for webpages that aren't served by the Handler,
+//     which connects to the endpoint above.
+//   - "/changed": the endpoint that editor plugins and build tools notify
+//     of changed files, either as a JSON body such as {"files":["style.css"]}
+//     or as a comma-separated "files" query parameter.
+//     It's protected like POST requests to the event path are,
+//     and the files are reloaded using [Handler.ReloadFiles].
+//
+// Since browsers don't apply CORS to WebSocket connections,
+// the WebSocket endpoint accepts connections from browser extensions,
+// and from the webpages of the origins allowed by [WithCORSOrigins]
+// or [WithTrustedOrigins], such as the ones that load "/livereload.js",
+// but not from other websites. Clients that aren't browsers are accepted.
+//
+// [LiveReload protocol]: http://livereload.com/api/protocol/
+func (h *Handler) LiveReloadProtocol() http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if !h.clientAllowed(req) {
+			http.Error(resp, "client not allowed", http.StatusForbidden)
+			return
+		}
+		switch req.URL.Path {
+		case "/livereload":
+			websocket.Server{
+				Handshake: func(_ *websocket.Config, req *http.Request) error {
+					if isExtensionOrigin(req.Header.Get("Origin")) ||
+						h.corsAllowed(req.Header.Get("Origin")) {
+						return nil
+					}
+					return h.checkOrigin(req)
+				},
+				Handler: h.serveLiveReload,
+			}.ServeHTTP(resp, req)
+		case "/livereload.js":
+			resp.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			resp.Header().Set("Cache-Control", "no-store")
+			resp.Write([]byte(lrScript))
+		case "/changed":
+			h.serveChanged(resp, req)
+		default:
+			http.NotFound(resp, req)
+		}
+	})
+}
+
+// maxChangedBodySize is the maximum size of the bodies of the requests
+// that LiveReload tools make to report changed files.
+const maxChangedBodySize = 1 << 20
+
+// isExtensionOrigin reports whether origin is that of a browser extension,
+// such as "chrome-extension://abc".
+func isExtensionOrigin(origin string) bool {
+	scheme, _, ok := strings.Cut(origin, "://")
+	if !ok {
+		return false
+	}
+	switch scheme {
+	case "chrome-extension", "moz-extension", "safari-web-extension", "ms-browser-extension":
+		return true
+	}
+	return false
+}
+
+// lrCommand is a message of the LiveReload protocol.
+type lrCommand struct {
+	Command    string   `json:"command"`
+	Protocols  []string `json:"protocols,omitempty"`
+	ServerName string   `json:"serverName,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	LiveCSS    bool     `json:"liveCSS,omitempty"`
+	LiveImg    bool     `json:"liveImg,omitempty"`
+}
+
+// serveLiveReload sends the reloads to a client of the LiveReload protocol,
+// once it has greeted the server.
+func (h *Handler) serveLiveReload(ws *websocket.Conn) {
+
+	events, unsub := h.sseHandler.Subscribe()
+	defer unsub()
+
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var hello lrCommand
+	if websocket.JSON.Receive(ws, &hello) != nil || hello.Command != "hello" {
+		return
+	}
+	ws.SetReadDeadline(time.Time{})
+	err := websocket.JSON.Send(ws, lrCommand{
+		Command:    "hello",
+		Protocols:  []string{lrProtocol},
+		ServerName: "go-livereload",
+	})
+	if err != nil {
+		return
+	}
+
+	// The commands the clients send, such as "info", are of no use;
+	// reading detects when the client closes the connection.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var cmd lrCommand
+			if websocket.JSON.Receive(ws, &cmd) != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			cmd, ok := lrReloadCommand(ev)
+			if !ok {
+				continue
+			}
+			if websocket.JSON.Send(ws, cmd) != nil {
+				return
+			}
+		}
+	}
+}
+
+// lrReloadCommand translates an event to a LiveReload reload command.
+// Events that are not reloads are skipped.
+func lrReloadCommand(ev sse.Event) (cmd lrCommand, ok bool) {
+	cmd = lrCommand{Command: "reload", Path: ev.Data}
+	switch ev.Type {
+	case "message":
+		if ev.Data != "reload" {
+			return cmd, false
+		}
+		cmd.Path = ""
+	case "css":
+		cmd.LiveCSS = true
+	case "image":
+		cmd.LiveImg = true
+	case "asset":
+		cmd.LiveCSS = true
+		cmd.LiveImg = true
+	case "module", "wasm", "paths":
+		// The protocol has no notion of these,
+		// so the webpages are reloaded.
+		cmd.Path = ""
+	default:
+		return cmd, false
+	}
+	return cmd, true
+}
+
+// serveChanged reloads the files that a LiveReload tool reports as changed.
+func (h *Handler) serveChanged(resp http.ResponseWriter, req *http.Request) {
+	err := h.checkTrigger(req)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusForbidden)
+		return
+	}
+	var files []string
+	if v := req.URL.Query().Get("files"); v != "" {
+		files = strings.Split(v, ",")
+	}
+	if req.Method == http.MethodPost && req.ContentLength != 0 {
+		var body struct {
+			Files []string `json:"files"`
+		}
+		err := json.NewDecoder(http.MaxBytesReader(resp, req.Body, maxChangedBodySize)).Decode(&body)
+		if err != nil {
+			http.Error(resp, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		files = append(files, body.Files...)
+	}
+	if len(files) == 0 {
+		h.Reload()
+	} else {
+		h.ReloadFiles(files...)
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(map[string][]string{"files": files})
+}
@@ -0,0 +1,52 @@
+(function () {
+	"use strict";
+
+	// This script is a client of the classic LiveReload protocol,
+	// for webpages that include livereload.js from the LiveReload port.
+
+	var url = new URL("livereload", document.currentScript.src);
+	url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+	connect();
+
+	function connect() {
+		var ws = new WebSocket(url.href);
+		ws.onopen = function () {
+			ws.send(JSON.stringify({
+				command: "hello",
+				protocols: ["http://livereload.com/protocols/official-7"],
+			}));
+		};
+		ws.onmessage = function (msg) {
+			var cmd = JSON.parse(msg.data);
+			if (cmd.command !== "reload") {
+				return;
+			}
+			if (cmd.liveCSS && refetch("link[rel~=stylesheet][href]", "href", cmd.path)) {
+				return;
+			}
+			if (cmd.liveImg && refetch("img[src]", "src", cmd.path)) {
+				return;
+			}
+			location.reload();
+		};
+		ws.onclose = function () {
+			setTimeout(connect, 1000);
+		};
+	}
+
+	// refetch re-fetches the elements whose attr URL has the same file name as path,
+	// or all of them if path is empty, and reports whether there were any.
+	function refetch(selector, attr, path) {
+		var name = path.split("/").pop();
+		var found = false;
+		document.querySelectorAll(selector).forEach(function (elem) {
+			var u = new URL(elem[attr]);
+			if (!name || u.pathname.split("/").pop() === name) {
+				u.searchParams.set("livereload", Date.now());
+				elem[attr] = u.href;
+				found = true;
+			}
+		});
+		return found;
+	}
+})();
@@ -0,0 +1,187 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/koonix/go-livereload/sse"
+)
+
+// Stats are the counters of a [Handler], as returned by [Handler.Stats].
+type Stats struct {
+	// Clients is the number of webpages and tools connected to the event path.
+	Clients int64
+
+	// Reloads is the number of reloads sent to the webpages,
+	// including the in-place ones such as those of stylesheets.
+	Reloads uint64
+
+	// Injected is the number of responses the script was injected into.
+	Injected uint64
+
+	// Skipped is the number of responses passed through without the script,
+	// such as those that aren't HTML, or are excluded using [WithInjectFilter].
+	Skipped uint64
+
+	// Failed is the number of responses the script couldn't be injected into,
+	// such as those whose HTML couldn't be parsed.
+	Failed uint64
+}
+
+// stats holds the counters of a [Handler].
+type stats struct {
+	clients  atomic.Int64
+	reloads  atomic.Uint64
+	injected atomic.Uint64
+	skipped  atomic.Uint64
+	failed   atomic.Uint64
+}
+
+// Stats returns the current counters of the Handler.
+// See also [Handler.MetricsHandler].
+func (h *Handler) Stats() Stats {
+	return Stats{
+		Clients:  h.stats.clients.Load(),
+		Reloads:  h.stats.reloads.Load(),
+		Injected: h.stats.injected.Load(),
+		Skipped:  h.stats.skipped.Load(),
+		Failed:   h.stats.failed.Load(),
+	}
+}
+
+// MetricsHandler returns an [http.Handler] that serves the counters of [Handler.Stats]
+// in the [Prometheus text format], for scraping by Prometheus and compatible tools:
+//
+//	http.Handle("/metrics", lr.MetricsHandler())
+//
+// [Prometheus text format]: https://prometheus.io/docs/instrumenting/exposition_formats/
+func (h *Handler) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		s := h.Stats()
+		resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		resp.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(resp,
+			"# HELP livereload_clients Webpages and tools connected to the event path.\n",
+			"# TYPE livereload_clients gauge\n",
+			"livereload_clients ", s.Clients, "\n",
+			"# HELP livereload_reloads_total Reloads sent to the webpages.\n",
+			"# TYPE livereload_reloads_total counter\n",
+			"livereload_reloads_total ", s.Reloads, "\n",
+			"# HELP livereload_injections_total Responses by the outcome of injecting the script.\n",
+			"# TYPE livereload_injections_total counter\n",
+			`livereload_injections_total{outcome="injected"} `, s.Injected, "\n",
+			`livereload_injections_total{outcome="skipped"} `, s.Skipped, "\n",
+			`livereload_injections_total{outcome="failed"} `, s.Failed, "\n",
+		)
+	})
+}
+
+// publishReload sends a reload event to the webpages, counting it,
+// or queues it if reloads are debounced.
+func (h *Handler) publishReload(eventType, data string) {
+	if h.reloadDebounce > 0 {
+		h.debounceReload(sse.Event{Type: eventType, Data: data})
+		return
+	}
+	h.sendReload(eventType, data)
+}
+
+// sendReload sends a reload event to the webpages, counting it.
+func (h *Handler) sendReload(eventType, data string) {
+	// Hide the overlay of the error cleared by the reload,
+	// since in-place reloads, such as of stylesheets, don't reload the webpages.
+	if h.buildError.Swap(nil) != nil {
+		h.sseHandler.Publish("build-error", "")
+	}
+	h.sseHandler.Publish(eventType, data)
+	h.stats.reloads.Add(1)
+	if h.onReload != nil {
+		h.onReload(sse.Event{Type: eventType, Data: data})
+	}
+}
+
+// clientConnected is called when a client connects to the event path,
+// and returns a function to call when it disconnects.
+func (h *Handler) clientConnected(req *http.Request) (disconnected func()) {
+	n := h.stats.clients.Add(1)
+	h.logger.Debug("livereload: client connected",
+		"remote_addr", req.RemoteAddr, "clients", n)
+	if h.onClientConnect != nil {
+		h.onClientConnect(req)
+	}
+	return func() {
+		n := h.stats.clients.Add(-1)
+		h.logger.Debug("livereload: client disconnected",
+			"remote_addr", req.RemoteAddr, "clients", n)
+		if h.onClientDisconnect != nil {
+			h.onClientDisconnect(req)
+		}
+	}
+}
+
+// injected counts a response the script was injected into.
+func (h *Handler) injected() {
+	h.stats.injected.Add(1)
+}
+
+// injectSkipped counts a response that's passed through without the script,
+// logging why.
+func (h *Handler) injectSkipped(req *http.Request, reason string) {
+	h.stats.skipped.Add(1)
+	h.logger.Debug("livereload: script not injected",
+		"method", req.Method, "path", req.URL.Path,
+		"reason", reason, "request_id", requestID(req))
+}
+
+// injectFailed counts a response the script couldn't be injected into,
+// logging the error.
+func (h *Handler) injectFailed(req *http.Request, err error) {
+	h.stats.failed.Add(1)
+	h.logger.Warn("livereload: could not inject the script",
+		"method", req.Method, "path", req.URL.Path,
+		"error", err, "request_id", requestID(req))
+}
+
+// ==========
+
+// WithLogger sets the logger of the Handler.
+// Reasons for not injecting the script into responses,
+// and clients connecting and disconnecting, are logged at the debug level.
+//
+// Defaults to [slog.Default].
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *Handler) {
+		h.logger = logger
+	}
+}
+
+// WithOnClientConnect sets a function that's called
+// when a webpage or tool connects to the event path.
+func WithOnClientConnect(fn func(req *http.Request)) Option {
+	return func(h *Handler) {
+		h.onClientConnect = fn
+	}
+}
+
+// WithOnClientDisconnect sets a function that's called
+// when a webpage or tool disconnects from the event path.
+func WithOnClientDisconnect(fn func(req *http.Request)) Option {
+	return func(h *Handler) {
+		h.onClientDisconnect = fn
+	}
+}
+
+// WithOnReload sets a function that's called
+// when a reload is sent to the webpages,
+// with the event sent, such as one of type "css"
+// with the path of the stylesheet as data.
+func WithOnReload(fn func(ev sse.Event)) Option {
+	return func(h *Handler) {
+		h.onReload = fn
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/koonix/go-livereload/internal/ready"
+	"github.com/koonix/go-livereload/internal/retrier"
+)
+
+// ReverseProxy returns an [http.Handler]
+// that sends it's requests to the given upstream URL
+// and returns it's responses.
+//
+// When used as the upstream of [New],
+// the upstream server is watched for restarts.
+// See [WithRestartDetection] for details.
+func ReverseProxy(upstream *url.URL, options ...ProxyOption) http.Handler {
+
+	rp := &reverseProxy{
+		addr: hostPort(upstream),
+		retryPolicy: RetryPolicy{
+			MaxElapsed:   10 * time.Second,
+			InitialDelay: 100 * time.Millisecond,
+			MaxDelay:     time.Second,
+			RetryStatus:  []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+			MaxBodySize:  1 << 20,
+		},
+		errorHandler: proxyErrorPage,
+	}
+	for _, fn := range options {
+		fn(rp)
+	}
+
+	transport := rp.transport
+	if transport == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		if rp.tlsConfig != nil {
+			t.TLSClientConfig = rp.tlsConfig
+		}
+		transport = t
+	}
+	if rp.retryPolicy.MaxElapsed > 0 {
+		transport = retrier.New(transport, retrier.Policy(rp.retryPolicy))
+	}
+
+	p := httputil.NewSingleHostReverseProxy(upstream)
+	p.Transport = transport
+	p.ErrorHandler = rp.errorHandler
+	origDirector := p.Director
+	p.Director = func(req *http.Request) {
+		host := req.Host
+		if rp.stripPrefix != "" {
+			stripPrefix(req.URL, rp.stripPrefix)
+		}
+		origDirector(req)
+		switch {
+		case rp.host != "":
+			req.Host = rp.host
+		case rp.preserveHost:
+			req.Host = host
+		default:
+			req.Host = ""
+		}
+	}
+	rp.ReverseProxy = p
+	return rp
+}
+
+type reverseProxy struct {
+	*httputil.ReverseProxy
+	addr         string
+	tlsConfig    *tls.Config
+	transport    http.RoundTripper
+	retryPolicy  RetryPolicy
+	preserveHost bool
+	host         string
+	stripPrefix  string
+	errorHandler func(resp http.ResponseWriter, req *http.Request, err error)
+}
+
+// RetryPolicy specifies when and how the requests to the upstream are retried,
+// such as while it's restarting. See [WithRetryPolicy].
+//
+// Requests that couldn't connect to the upstream are retried regardless of their method,
+// since they never reached it.
+// Other failed requests, and the responses with a status in RetryStatus,
+// are only retried if the request is idempotent:
+// if its method is GET, HEAD, OPTIONS, TRACE, PUT or DELETE,
+// or it has an "Idempotency-Key" header.
+type RetryPolicy struct {
+	// MaxElapsed is how long to keep retrying a request for
+	// before responding with the error or the last response.
+	// Zero disables retrying.
+	MaxElapsed time.Duration
+
+	// InitialDelay is the delay before the first retry,
+	// which doubles with every retry up to MaxDelay.
+	// Each delay is randomized to between half of it and all of it.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+
+	// RetryStatus are the upstream response status codes that are retried.
+	// The Retry-After header of those responses is honored
+	// if it's within MaxElapsed.
+	RetryStatus []int
+
+	// MaxBodySize is the largest request body that's buffered in memory
+	// so that it can be resent. Requests with larger bodies aren't retried.
+	MaxBodySize int64
+}
+
+func (p *reverseProxy) watchRestarts(ctx context.Context, fn func()) {
+	ready.WatchRestarts(ctx, p.addr, 500*time.Millisecond, fn)
+}
+
+// restartWatcher is implemented by upstreams that can detect their own restarts.
+type restartWatcher interface {
+	watchRestarts(ctx context.Context, fn func())
+}
+
+// hostPort returns the host and port of u,
+// using the default port of the scheme if u doesn't specify one.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// stripPrefix removes prefix from the path of u, if it has it.
+func stripPrefix(u *url.URL, prefix string) {
+	p, ok := strings.CutPrefix(u.Path, prefix)
+	if !ok {
+		return
+	}
+	u.Path = p
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	u.RawPath = ""
+}
+
+// proxyErrorPage responds to the requests the upstream couldn't be reached for,
+// such as while it's restarting, with a 502 Bad Gateway.
+// Navigations get a styled error page, which the [Handler] in front of the proxy
+// inserts its script into like any other page, so it's reloaded with the next reload.
+// Other requests get a plain-text error.
+func proxyErrorPage(resp http.ResponseWriter, req *http.Request, err error) {
+	if !isNavigation(req) {
+		http.Error(resp, "could not reach the upstream: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeErrorPage(resp, errorPage{
+		Status:    http.StatusBadGateway,
+		Title:     "Waiting for the upstream",
+		Message:   fmt.Sprintf("Could not reach the upstream for %s %s. The page reloads once it's back up.", req.Method, req.URL.Path),
+		Details:   err.Error(),
+		RequestID: requestID(req),
+	}, "")
+}
+
+// ==========
+
+type ProxyOption func(p *reverseProxy)
+
+// WithRoundTripper sets the transport used to make the requests to the upstream,
+// in place of a clone of [http.DefaultTransport].
+// The TLS options, such as [WithClientCertificate], only apply to the default transport.
+func WithRoundTripper(rt http.RoundTripper) ProxyOption {
+	return func(p *reverseProxy) {
+		p.transport = rt
+	}
+}
+
+// WithRetries sets the delay before the first retry of a request to the upstream,
+// and for how long to keep retrying before responding with an error,
+// such as while the upstream is restarting.
+// It's a shorthand for setting InitialDelay and MaxElapsed of the [RetryPolicy].
+// A timeout of zero disables retrying.
+//
+// Defaults to 100ms and 10s.
+func WithRetries(delay, timeout time.Duration) ProxyOption {
+	return func(p *reverseProxy) {
+		p.retryPolicy.InitialDelay = delay
+		p.retryPolicy.MaxElapsed = timeout
+	}
+}
+
+// WithRetryPolicy sets when and how the requests to the upstream are retried.
+// A zero RetryPolicy disables retrying.
+//
+// Defaults to retrying for up to 10s, with delays from 100ms up to 1s,
+// the responses with status 502, 503 and 504,
+// and buffering request bodies of up to 1MiB.
+func WithRetryPolicy(policy RetryPolicy) ProxyOption {
+	return func(p *reverseProxy) {
+		p.retryPolicy = policy
+	}
+}
+
+// WithInsecureSkipVerify configures whether to skip verifying
+// the certificates of HTTPS upstreams, for development servers
+// that use self-signed certificates.
+//
+// Defaults to false.
+func WithInsecureSkipVerify(v bool) ProxyOption {
+	return func(p *reverseProxy) {
+		p.tls().InsecureSkipVerify = v
+	}
+}
+
+// WithPreserveHost configures whether the Host header of the requests
+// is passed to the upstream as-is, for upstreams that serve multiple hosts,
+// instead of being set to the host of the upstream URL.
+//
+// Defaults to false.
+func WithPreserveHost(v bool) ProxyOption {
+	return func(p *reverseProxy) {
+		p.preserveHost = v
+	}
+}
+
+// WithHost sets the Host header of the requests passed to the upstream,
+// overriding [WithPreserveHost].
+func WithHost(host string) ProxyOption {
+	return func(p *reverseProxy) {
+		p.host = host
+	}
+}
+
+// WithStripPrefix removes the given prefix from the paths of the requests
+// before passing them to the upstream, such as for proxying "/api/users"
+// to an upstream that serves "/users". Paths without the prefix are passed as-is.
+func WithStripPrefix(prefix string) ProxyOption {
+	return func(p *reverseProxy) {
+		p.stripPrefix = prefix
+	}
+}
+
+// WithErrorHandler sets the function that responds to the requests
+// the upstream couldn't be reached for.
+//
+// Defaults to responding to navigations with an error page
+// that's reloaded once the upstream is back up, if restart detection is enabled,
+// and to the other requests with a plain error.
+func WithErrorHandler(fn func(resp http.ResponseWriter, req *http.Request, err error)) ProxyOption {
+	return func(p *reverseProxy) {
+		p.errorHandler = fn
+	}
+}
+
+// WithClientCertificate sets the certificate
+// presented to HTTPS upstreams that require mutual TLS authentication.
+// Use [tls.LoadX509KeyPair] to load it from files.
+func WithClientCertificate(cert tls.Certificate) ProxyOption {
+	return func(p *reverseProxy) {
+		p.tls().Certificates = append(p.tls().Certificates, cert)
+	}
+}
+
+// WithRootCAs sets the certificate authorities
+// used to verify the certificates of HTTPS upstreams,
+// such as the private authority of a service mesh.
+//
+// Defaults to the system's certificate authorities.
+func WithRootCAs(pool *x509.CertPool) ProxyOption {
+	return func(p *reverseProxy) {
+		p.tls().RootCAs = pool
+	}
+}
+
+// tls returns the TLS configuration of the proxy, creating it if necessary.
+func (p *reverseProxy) tls() *tls.Config {
+	if p.tlsConfig == nil {
+		p.tlsConfig = new(tls.Config)
+	}
+	return p.tlsConfig
+}
@@ -0,0 +1,343 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package pubsub provides publish-subscribe functionality
+// that's designed to scale down to zero subscribers
+// without leaking any goroutines.
+//
+// Messages are published to topics,
+// and delivered to the subscribers of those topics:
+//
+//	ps := pubsub.New[string]()
+//	defer ps.Close()
+//	msgs, unsubscribe := ps.Subscribe("builds")
+//	defer unsubscribe()
+//	ps.Publish("builds", "started")
+//
+// Each subscriber has a queue of its own, and a policy for when it fills up,
+// so a slow subscriber doesn't hold up the others unless it's configured to.
+package pubsub
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// PubSub delivers the messages published to a topic
+// to each subscriber of the topic,
+// in the order they were published in.
+type PubSub[T any] struct {
+	msg       chan published[T]
+	addSub    chan *sub[T]
+	removeSub chan *sub[T]
+	done      chan struct{}
+	once      sync.Once
+}
+
+type published[T any] struct {
+	topic string
+	msg   T
+}
+
+// Policy specifies what happens when a message is published
+// to a subscriber whose queue is full.
+// See [WithBufferSize].
+type Policy int
+
+const (
+	// DropOldest drops the oldest queued message of the subscriber
+	// to make room for the new one, without holding up the publisher.
+	DropOldest Policy = iota
+
+	// Block holds up the delivery of the message to all the subscribers,
+	// and the publishers with it, until the subscriber receives a message.
+	// If it doesn't within the timeout set by [WithBlockTimeout],
+	// it's unsubscribed, and its channel is closed
+	// once it receives the already queued messages.
+	//
+	// Messages are delivered one at a time for all the topics,
+	// so a blocked subscriber holds up the publishers and subscribers
+	// of the other topics as well, for up to the timeout.
+	Block
+)
+
+type sub[T any] struct {
+	settings
+	topic string
+
+	msg  chan T
+	done chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	queue  []T
+	closed bool
+
+	// notify is signaled when queue or closed changes.
+	notify chan struct{}
+
+	// space is signaled when a message is taken from queue.
+	space chan struct{}
+}
+
+func New[T any]() *PubSub[T] {
+
+	p := &PubSub[T]{
+		msg:       make(chan published[T]),
+		addSub:    make(chan *sub[T]),
+		removeSub: make(chan *sub[T]),
+		done:      make(chan struct{}),
+	}
+	runtime.SetFinalizer(p, func(p *PubSub[T]) {
+		p.Close()
+	})
+
+	msg := p.msg
+	addSub := p.addSub
+	removeSub := p.removeSub
+	done := p.done
+
+	go func() {
+		topics := make(map[string]map[*sub[T]]struct{})
+		remove := func(sub *sub[T]) {
+			subs := topics[sub.topic]
+			delete(subs, sub)
+			if len(subs) == 0 {
+				delete(topics, sub.topic)
+			}
+			sub.close()
+		}
+		defer func() {
+			for _, subs := range topics {
+				for sub := range subs {
+					sub.close()
+				}
+			}
+		}()
+		for {
+			select {
+			case <-done:
+				return
+			case s := <-addSub:
+				if topics[s.topic] == nil {
+					topics[s.topic] = make(map[*sub[T]]struct{})
+				}
+				topics[s.topic][s] = struct{}{}
+			case sub := <-removeSub:
+				remove(sub)
+			case msg := <-msg:
+				for sub := range topics[msg.topic] {
+					if !sub.push(msg.msg) {
+						remove(sub)
+					}
+				}
+			}
+		}
+	}()
+
+	return p
+}
+
+// Subscribe returns a channel that receives the messages published to topic
+// from now on, which is closed once unsubscribe or [PubSub.Close] is called.
+//
+// By default, the queue of the subscriber holds up to 256 messages,
+// beyond which its oldest messages are dropped,
+// so that a subscriber that stops receiving doesn't hold up the publishers
+// or grow its queue without bound.
+// Use the [WithBufferSize] and [WithPolicy] options to change that.
+func (p *PubSub[T]) Subscribe(topic string, options ...Option) (msg <-chan T, unsubscribe func()) {
+
+	sub := &sub[T]{
+		settings: settings{bufferSize: defaultBufferSize, blockTimeout: time.Second},
+		topic:    topic,
+		msg:      make(chan T),
+		done:     make(chan struct{}),
+		notify:   make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+	}
+	for _, fn := range options {
+		fn(&sub.settings)
+	}
+	go sub.run()
+
+	select {
+	case p.addSub <- sub:
+	case <-p.done:
+		sub.close()
+	}
+
+	unsub := func() {
+		sub.once.Do(func() {
+			close(sub.done)
+			select {
+			case p.removeSub <- sub:
+			case <-p.done:
+			}
+		})
+	}
+
+	return sub.msg, unsub
+}
+
+// Publish queues msg for delivery to the current subscribers of topic.
+// It doesn't wait for them to receive it,
+// unless a subscriber with the [Block] policy has a full queue,
+// in which case any publisher waits, regardless of the topic.
+func (p *PubSub[T]) Publish(topic string, msg T) {
+	select {
+	case p.msg <- published[T]{topic: topic, msg: msg}:
+	case <-p.done:
+	}
+}
+
+// Close closes the channels of the subscribers
+// once they receive the already published messages.
+func (p *PubSub[T]) Close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
+
+// ==========
+
+// defaultBufferSize is the default of [WithBufferSize].
+const defaultBufferSize = 256
+
+// settings holds the options of a subscriber,
+// which are independent of the type of its messages.
+type settings struct {
+	bufferSize   int
+	policy       Policy
+	blockTimeout time.Duration
+}
+
+// push queues msg for delivery,
+// and reports whether the subscriber should be kept,
+// which is not the case if it's blocked for longer than its timeout.
+func (s *sub[T]) push(msg T) bool {
+	var timeout <-chan time.Time
+	for {
+		s.mu.Lock()
+		if s.bufferSize <= 0 || len(s.queue) < s.bufferSize {
+			s.queue = append(s.queue, msg)
+			s.mu.Unlock()
+			s.signal()
+			return true
+		}
+		if s.policy == DropOldest {
+			var zero T
+			s.queue[0] = zero
+			s.queue = append(s.queue[1:], msg)
+			s.mu.Unlock()
+			s.signal()
+			return true
+		}
+		s.mu.Unlock()
+
+		if timeout == nil {
+			t := time.NewTimer(s.blockTimeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case <-s.space:
+		case <-s.done:
+			return true
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+// close closes the channel once the queued messages are delivered.
+func (s *sub[T]) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *sub[T]) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the queued messages in order,
+// until the subscriber unsubscribes or the sub is closed.
+func (s *sub[T]) run() {
+	defer close(s.msg)
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			msg := s.queue[0]
+			var zero T
+			s.queue[0] = zero
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			select {
+			case s.space <- struct{}{}:
+			default:
+			}
+			select {
+			case s.msg <- msg:
+			case <-s.done:
+				return
+			}
+			continue
+		}
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// ==========
+
+// Option configures a subscriber. See [PubSub.Subscribe].
+type Option func(s *settings)
+
+// WithBufferSize bounds the queue of the subscriber to n messages,
+// not counting the one it's being handed,
+// applying the policy set by [WithPolicy] once it fills up.
+// Zero means the queue is unbounded, so messages are never dropped,
+// at the cost of memory growing while the subscriber doesn't receive.
+//
+// Defaults to 256.
+func WithBufferSize(n int) Option {
+	return func(s *settings) {
+		s.bufferSize = n
+	}
+}
+
+// WithPolicy sets what happens when a message is published
+// to the subscriber while its queue is full.
+//
+// Defaults to [DropOldest].
+func WithPolicy(p Policy) Option {
+	return func(s *settings) {
+		s.policy = p
+	}
+}
+
+// WithBlockTimeout sets how long the delivery of a message
+// is held up for the subscriber with the [Block] policy
+// before it's unsubscribed.
+//
+// Defaults to 1s.
+func WithBlockTimeout(d time.Duration) Option {
+	return func(s *settings) {
+		s.blockTimeout = d
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package pubsub
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPubSub(t *testing.T) {
+
+	ps := New[string]()
+	wg := new(sync.WaitGroup)
+	rcvCount := new(atomic.Int64)
+	msg := "hello world"
+
+	ch1, unsub1 := ps.Subscribe("")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer unsub1()
+		for m := range ch1 {
+			if m == msg {
+				rcvCount.Add(1)
+			} else {
+				t.Errorf("ch1 got incorrect message; want %q, got %q", msg, m)
+			}
+		}
+	}()
+
+	ch2, unsub2 := ps.Subscribe("")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer unsub2()
+		for m := range ch2 {
+			if m == msg {
+				rcvCount.Add(1)
+			} else {
+				t.Errorf("ch2 got incorrect message; want %q, got %q", msg, m)
+			}
+		}
+	}()
+
+	ch3, unsub3 := ps.Subscribe("")
+	unsub3() // Unsubscribe immediately.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer unsub3()
+		for range ch3 {
+			t.Errorf("ch3 got message, didn't expect any")
+		}
+	}()
+
+	ps.Publish("", msg)
+	ps.Close()
+	wg.Wait()
+
+	want := 2
+	got := int(rcvCount.Load())
+	if want != got {
+		t.Errorf("incorrect message count; want %d, got %d", want, got)
+	}
+}
+
+func TestPubSubFinalizer(t *testing.T) {
+
+	// Create the PubSub inside an inner scope
+	// so the pointer becomes unreachable when we leave the block.
+	done := func() <-chan struct{} {
+		p := New[int]()
+		return p.done
+	}()
+
+	runtime.GC()
+
+	select {
+	case <-done:
+		// Success.
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("finalizer did not run")
+	}
+}
+
+func TestPubSubOrder(t *testing.T) {
+
+	const (
+		subCount     = 20
+		pubCount     = 4
+		messageCount = 500
+	)
+
+	type message struct {
+		publisher int
+		seq       int
+	}
+
+	ps := New[message]()
+	wg := new(sync.WaitGroup)
+
+	for i := range subCount {
+		ch, unsub := ps.Subscribe("", WithBufferSize(0))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer unsub()
+			next := make([]int, pubCount)
+			for m := range ch {
+				if m.seq != next[m.publisher] {
+					t.Errorf("subscriber %d got message %d of publisher %d out of order; want %d",
+						i, m.seq, m.publisher, next[m.publisher])
+					return
+				}
+				next[m.publisher]++
+				// Make some of the subscribers slow.
+				if i%5 == 0 && m.seq%50 == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			for p, n := range next {
+				if n != messageCount {
+					t.Errorf("subscriber %d got %d messages of publisher %d; want %d", i, n, p, messageCount)
+				}
+			}
+		}()
+	}
+
+	pubWG := new(sync.WaitGroup)
+	for p := range pubCount {
+		pubWG.Add(1)
+		go func() {
+			defer pubWG.Done()
+			for seq := range messageCount {
+				ps.Publish("", message{publisher: p, seq: seq})
+			}
+		}()
+	}
+	pubWG.Wait()
+	ps.Close()
+	wg.Wait()
+}
+
+func TestPubSubSlowSubscriber(t *testing.T) {
+
+	ps := New[int]()
+	defer ps.Close()
+
+	// A subscriber that never receives.
+	_, unsub := ps.Subscribe("")
+	defer unsub()
+
+	ch, unsub2 := ps.Subscribe("")
+	defer unsub2()
+
+	go func() {
+		for i := range 100 {
+			ps.Publish("", i)
+		}
+	}()
+	for i := range 100 {
+		select {
+		case m := <-ch:
+			if m != i {
+				t.Fatalf("incorrect message; want %d, got %d", i, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("held up by the slow subscriber at message %d", i)
+		}
+	}
+}
+
+func TestPubSubTopics(t *testing.T) {
+
+	ps := New[string]()
+	defer ps.Close()
+
+	builds, unsub1 := ps.Subscribe("builds")
+	defer unsub1()
+	logs, unsub2 := ps.Subscribe("logs")
+	defer unsub2()
+
+	ps.Publish("builds", "started")
+	ps.Publish("logs", "compiling")
+	ps.Publish("other", "ignored")
+
+	for _, test := range []struct {
+		ch   <-chan string
+		want string
+	}{
+		{builds, "started"},
+		{logs, "compiling"},
+	} {
+		select {
+		case m := <-test.ch:
+			if m != test.want {
+				t.Errorf("incorrect message; want %q, got %q", test.want, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("did not get message %q", test.want)
+		}
+	}
+	select {
+	case m := <-builds:
+		t.Errorf("got message of another topic: %q", m)
+	case m := <-logs:
+		t.Errorf("got message of another topic: %q", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPubSubPolicies(t *testing.T) {
+
+	t.Run("drop-oldest", func(t *testing.T) {
+		ps := New[int]()
+		defer ps.Close()
+		ch, unsub := ps.Subscribe("", WithBufferSize(2), WithPolicy(DropOldest))
+		defer unsub()
+		for i := range 10 {
+			ps.Publish("", i)
+		}
+		// The queue keeps the latest messages,
+		// after the one being handed to the subscriber, if any.
+		var got []int
+	loop:
+		for {
+			select {
+			case m := <-ch:
+				got = append(got, m)
+			case <-time.After(50 * time.Millisecond):
+				break loop
+			}
+		}
+		if len(got) < 2 || len(got) > 3 || !slices.Equal(got[len(got)-2:], []int{8, 9}) {
+			t.Errorf("incorrect messages; want the last 2 and at most one other, got %v", got)
+		}
+	})
+
+	t.Run("default-bounded", func(t *testing.T) {
+		ps := New[int]()
+		defer ps.Close()
+		ch, unsub := ps.Subscribe("")
+		defer unsub()
+		for i := range 1000 {
+			ps.Publish("", i)
+		}
+		var got []int
+	loop:
+		for {
+			select {
+			case m := <-ch:
+				got = append(got, m)
+			case <-time.After(50 * time.Millisecond):
+				break loop
+			}
+		}
+		if len(got) > defaultBufferSize+1 || got[len(got)-1] != 999 {
+			t.Errorf("queue not bounded by default; got %d messages ending in %d", len(got), got[len(got)-1])
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		ps := New[int]()
+		defer ps.Close()
+		slow, unsub1 := ps.Subscribe("", WithBufferSize(1), WithPolicy(Block), WithBlockTimeout(50*time.Millisecond))
+		defer unsub1()
+		fast, unsub2 := ps.Subscribe("")
+		defer unsub2()
+
+		start := time.Now()
+		for i := range 4 {
+			ps.Publish("", i)
+		}
+		for i := range 4 {
+			if m := <-fast; m != i {
+				t.Fatalf("incorrect message; want %d, got %d", i, m)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("publishing not held up by the blocked subscriber: %s", elapsed)
+		}
+
+		// The blocked subscriber is unsubscribed,
+		// receiving the messages queued before that.
+		var got []int
+		for m := range slow {
+			got = append(got, m)
+		}
+		want := []int{0, 1}
+		if !slices.Equal(got, want) {
+			t.Errorf("incorrect messages; want %v, got %v", want, got)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// upstreamPanic is a panic recovered from the upstream.
+type upstreamPanic struct {
+	value any
+	stack []byte
+}
+
+// handlePanic responds to a request whose upstream handler panicked.
+// sent reports whether the upstream response has already been sent downstream.
+//
+// Webpages navigated to get an error page with the stack trace.
+// For other requests, such as those made by the scripts of a webpage,
+// the open webpages show the stack trace in an overlay instead.
+func (h *Handler) handlePanic(resp http.ResponseWriter, req *http.Request, p *upstreamPanic, sent bool) {
+
+	// The upstream aborted the response on purpose,
+	// such as when the connection to a proxied server is lost.
+	// Abort the downstream response too, like net/http does.
+	if p.value == http.ErrAbortHandler {
+		panic(http.ErrAbortHandler)
+	}
+
+	msg := fmt.Sprintf("panic serving %s %s: %v", req.Method, req.URL.Path, p.value)
+	h.logger.Error("livereload: "+msg, "request_id", requestID(req), "stack", string(p.stack))
+
+	if !sent && isNavigation(req) {
+		h.writeErrorPage(resp, errorPage{
+			Status:    http.StatusInternalServerError,
+			Title:     "Upstream panicked",
+			Message:   msg,
+			Details:   string(p.stack),
+			RequestID: requestID(req),
+		})
+		return
+	}
+
+	h.sseHandler.Publish("overlay", msg+"\n\n"+string(p.stack))
+	if sent {
+		panic(http.ErrAbortHandler)
+	}
+	clearHeader(resp.Header())
+	resp.Header().Set(requestIDHeader, requestID(req))
+	http.Error(resp, msg, http.StatusInternalServerError)
+}
+
+// isNavigation reports whether req is made by the browser
+// to navigate to a webpage, as opposed to being made by a script.
+func isNavigation(req *http.Request) bool {
+	if dest := req.Header.Get("Sec-Fetch-Dest"); dest != "" {
+		return dest == "document" || dest == "iframe"
+	}
+	return strings.Contains(req.Header.Get("Accept"), "text/html")
+}
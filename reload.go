@@ -0,0 +1,174 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ReloadKind specifies how webpages are updated after a file changes.
+type ReloadKind int
+
+const (
+	// ReloadPage reloads the whole webpage.
+	ReloadPage ReloadKind = iota
+
+	// ReloadCSS re-fetches the stylesheets of the webpage in place,
+	// preserving the state of the webpage.
+	ReloadCSS
+
+	// ReloadImage re-fetches the images of the webpage in place,
+	// preserving the state of the webpage.
+	ReloadImage
+
+	// ReloadWASM deletes the WebAssembly modules
+	// stored in the webpage's [CacheStorage] and reloads the whole webpage,
+	// so that the modules are recompiled.
+	//
+	// [CacheStorage]: https://developer.mozilla.org/en-US/docs/Web/API/CacheStorage
+	ReloadWASM
+
+	// ReloadModule re-imports the changed JavaScript modules of the webpage
+	// and passes them to its accept hook, preserving the state of the webpage
+	// if the hook applies them:
+	//
+	//	window.livereload = window.livereload || {};
+	//	window.livereload.accept = function (url, module) {
+	//		if (!url.endsWith("/render.js")) return false;
+	//		render = module.render;
+	//		render();
+	//		return true;
+	//	};
+	//
+	// The whole webpage is reloaded if it has no accept hook,
+	// or the hook doesn't return true.
+	// Modules match files by file name, like stylesheets do.
+	// Only the changed modules are re-imported;
+	// the modules they import are not.
+	ReloadModule
+)
+
+// defaultReloadKinds returns the reload kinds of file extensions
+// that don't need a full reload.
+func defaultReloadKinds() map[string]ReloadKind {
+	return map[string]ReloadKind{
+		".css":  ReloadCSS,
+		".apng": ReloadImage,
+		".avif": ReloadImage,
+		".bmp":  ReloadImage,
+		".gif":  ReloadImage,
+		".ico":  ReloadImage,
+		".jpeg": ReloadImage,
+		".jpg":  ReloadImage,
+		".png":  ReloadImage,
+		".svg":  ReloadImage,
+		".webp": ReloadImage,
+		".wasm": ReloadWASM,
+	}
+}
+
+// ReloadKindOf returns how webpages are updated
+// after the file at path changes, based on its extension.
+//
+// Stylesheets are reloaded using [ReloadCSS],
+// images using [ReloadImage], WebAssembly modules using [ReloadWASM],
+// and everything else using [ReloadPage].
+// Use the [WithReloadKind] option to change this.
+func (h *Handler) ReloadKindOf(path string) ReloadKind {
+	ext := strings.ToLower(filepath.Ext(path))
+	kind, ok := h.reloadKinds[ext]
+	if !ok {
+		return ReloadPage
+	}
+	return kind
+}
+
+// ReloadFiles updates the webpages after the files at paths change,
+// as specified by [Handler.ReloadKindOf].
+//
+// If any of the files needs a full reload, the webpages are reloaded once,
+// clearing their WebAssembly caches if any of the files is a WebAssembly module.
+// Otherwise, the matching stylesheets and images are re-fetched in place,
+// and the matching JavaScript modules are re-imported.
+// Webpages match files by file name,
+// and re-fetch all their stylesheets or images if none match.
+func (h *Handler) ReloadFiles(paths ...string) {
+	kinds := make(map[ReloadKind]bool)
+	for _, path := range paths {
+		kinds[h.ReloadKindOf(path)] = true
+	}
+	if kinds[ReloadWASM] {
+		h.publishReload("wasm", "")
+		return
+	}
+	if kinds[ReloadPage] {
+		h.Reload()
+		return
+	}
+	for _, path := range paths {
+		path = filepath.ToSlash(path)
+		switch h.ReloadKindOf(path) {
+		case ReloadCSS:
+			h.publishReload("css", path)
+		case ReloadImage:
+			h.publishReload("image", path)
+		case ReloadModule:
+			h.publishReload("module", path)
+		}
+	}
+}
+
+// ReloadCSS re-fetches all the stylesheets of the webpages in place,
+// preserving the state of the webpages.
+func (h *Handler) ReloadCSS() {
+	h.publishReload("css", "")
+}
+
+// ReloadAsset re-fetches the stylesheets and images of the webpages
+// that match the asset at path in place, preserving the state of the webpages,
+// regardless of the reload kind of the path.
+// Webpages match assets by file name,
+// and re-fetch all their stylesheets and images if none match,
+// since the asset may be referenced by the stylesheets,
+// such as a font or a background image.
+func (h *Handler) ReloadAsset(path string) {
+	h.publishReload("asset", filepath.ToSlash(path))
+}
+
+// ReloadPaths signals the webpages whose URL paths match any of the given patterns
+// to reload, leaving the others be, such as after a template
+// that only some of the pages use changes:
+//
+//	lr.ReloadPaths("/docs/", "/index.html")
+//
+// In the patterns, "*" matches any sequence of characters other than slashes,
+// and "?" matches any single character other than a slash, like in [path.Match].
+// Patterns ending in a slash match the paths under them, too.
+// If no patterns are given, all webpages are reloaded, like [Handler.Reload] does.
+func (h *Handler) ReloadPaths(patterns ...string) {
+	if len(patterns) == 0 {
+		h.Reload()
+		return
+	}
+	h.publishReload("paths", strings.Join(patterns, "\n"))
+}
+
+// ReloadError shows msg, such as the output of a failed build,
+// in a dismissible overlay covering the webpages,
+// so that the failure is noticed instead of the webpages going stale.
+// The webpages that load while the error is set show it, too.
+// The error is cleared by the next reload, or by [Handler.ClearError].
+func (h *Handler) ReloadError(msg string) {
+	h.buildError.Store(&msg)
+	h.sseHandler.Publish("build-error", msg)
+}
+
+// ClearError clears the error set by [Handler.ReloadError],
+// hiding its overlay, such as when a build succeeds without changing anything.
+func (h *Handler) ClearError() {
+	if h.buildError.Swap(nil) != nil {
+		h.sseHandler.Publish("build-error", "")
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"net/http"
+)
+
+// requestIDHeader is the header carrying the ID of a request,
+// which is used for correlating a request across the servers it passes through.
+const requestIDHeader = "X-Request-Id"
+
+// setRequestID makes sure req has an ID, generating one if it has none,
+// so that the upstream receives it.
+func setRequestID(req *http.Request) {
+	if req.Header.Get(requestIDHeader) == "" {
+		req.Header.Set(requestIDHeader, randomHex(8))
+	}
+}
+
+// requestID returns the ID of req set by setRequestID.
+func requestID(req *http.Request) string {
+	return req.Header.Get(requestIDHeader)
+}
@@ -0,0 +1,296 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/koonix/go-livereload/internal/ready"
+)
+
+// Runner runs a build command and restarts a server command when triggered,
+// and updates the webpages using [Handler.Reload]
+// only once the build has succeeded and the server is ready,
+// so that the webpages aren't reloaded while the upstream is still being rebuilt.
+//
+// Rebuild and restart an upstream whenever its source files change:
+//
+//	r := livereload.NewRunner(lr,
+//		livereload.WithBuildCommand("go", "build", "-o", "server", "./cmd/server"),
+//		livereload.WithServerCommand("./server"),
+//		livereload.WithReadyAddr("localhost:8080"),
+//	)
+//	go r.Run(ctx)
+//	go livereload.NewWatcher(lr, livereload.WithOnChange(r.Trigger)).Watch(ctx, ".")
+type Runner struct {
+	handler      *Handler
+	build        []string
+	server       []string
+	readyAddr    string
+	readyURL     string
+	readyTimeout time.Duration
+	stopTimeout  time.Duration
+	stdout       io.Writer
+	stderr       io.Writer
+
+	// trigger receives a value when a run is requested.
+	// It's buffered so that the triggers during a build aren't lost,
+	// and further triggers are coalesced into that single value.
+	trigger chan struct{}
+}
+
+// NewRunner creates a [Runner] that updates the webpages of h.
+func NewRunner(h *Handler, options ...RunnerOption) *Runner {
+	r := &Runner{
+		handler:      h,
+		readyTimeout: 30 * time.Second,
+		stopTimeout:  5 * time.Second,
+		stdout:       os.Stdout,
+		stderr:       os.Stderr,
+		trigger:      make(chan struct{}, 1),
+	}
+	for _, fn := range options {
+		fn(r)
+	}
+	return r
+}
+
+// Trigger requests a rebuild. It doesn't block.
+// The changed paths are ignored;
+// they're accepted so that Trigger can be passed to [WithOnChange].
+func (r *Runner) Trigger(changed ...string) {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run builds and starts the server once, and then again whenever triggered,
+// until ctx is done, at which point the server is stopped and Run returns.
+//
+// The server keeps running while it's being rebuilt,
+// and is only restarted if the build succeeds.
+// If the build fails, the webpages aren't reloaded,
+// and its output is shown on them using [Handler.ReloadError].
+func (r *Runner) Run(ctx context.Context) {
+	stop := func() {}
+	for {
+		if r.runBuild(ctx) {
+			stop()
+			stop = r.start(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			return
+		case <-r.trigger:
+		}
+	}
+}
+
+// runBuild runs the build command, if any,
+// and reports whether it succeeded.
+func (r *Runner) runBuild(ctx context.Context) bool {
+	if len(r.build) == 0 {
+		return true
+	}
+	// output is shown on the webpages if the build fails.
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.build[0], r.build[1:]...)
+	cmd.Stdout = io.MultiWriter(r.stdout, &output)
+	cmd.Stderr = io.MultiWriter(r.stderr, &output)
+	err := cmd.Run()
+	if err != nil {
+		if ctx.Err() == nil {
+			command := strings.Join(r.build, " ")
+			r.handler.logger.Error("livereload: build failed",
+				"command", command, "error", err)
+			r.handler.ReloadError(fmt.Sprintf("%s: %s\n\n%s", command, err, output.Bytes()))
+		}
+		return false
+	}
+	return true
+}
+
+// start starts the server command, if any,
+// and reloads the webpages once it's ready.
+// The returned function stops the server.
+func (r *Runner) start(ctx context.Context) (stop func()) {
+
+	readyCtx, cancel := context.WithTimeout(ctx, r.readyTimeout)
+	stop = cancel
+
+	if len(r.server) > 0 {
+		cmd := exec.Command(r.server[0], r.server[1:]...)
+		cmd.Stdout = r.stdout
+		cmd.Stderr = r.stderr
+		err := cmd.Start()
+		if err != nil {
+			r.handler.logger.Error("livereload: could not start the server",
+				"command", strings.Join(r.server, " "), "error", err)
+			cancel()
+			return func() {}
+		}
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+		// Stop waiting for the server if it exits before getting ready.
+		go func() {
+			select {
+			case <-exited:
+				cancel()
+			case <-readyCtx.Done():
+			}
+		}()
+		stop = func() {
+			cancel()
+			terminate(cmd.Process, exited, r.stopTimeout)
+		}
+	}
+
+	go func() {
+		err := r.waitReady(readyCtx)
+		switch {
+		case err == nil:
+			r.handler.Reload()
+		case ctx.Err() == nil && err == context.DeadlineExceeded:
+			r.handler.logger.Error("livereload: the server did not get ready",
+				"timeout", r.readyTimeout)
+		}
+	}()
+
+	return stop
+}
+
+// waitReady blocks until the readiness probe passes.
+func (r *Runner) waitReady(ctx context.Context) error {
+	const interval = 100 * time.Millisecond
+	switch {
+	case r.readyURL != "":
+		return waitHTTP(ctx, r.readyURL, interval)
+	case r.readyAddr != "":
+		return ready.WaitTCP(ctx, r.readyAddr, interval)
+	default:
+		return ctx.Err()
+	}
+}
+
+// waitHTTP blocks until a GET request to url
+// gets a response that's not a server error, retrying every interval.
+func waitHTTP(ctx context.Context, url string, interval time.Duration) error {
+	client := &http.Client{Timeout: interval * 10}
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// terminate asks the process to exit,
+// and kills it if it doesn't exit within timeout.
+func terminate(p *os.Process, exited <-chan struct{}, timeout time.Duration) {
+	err := p.Signal(os.Interrupt)
+	if err != nil { // Interrupting is not supported on windows.
+		p.Kill()
+	}
+	select {
+	case <-exited:
+	case <-time.After(timeout):
+		p.Kill()
+		<-exited
+	}
+}
+
+// ==========
+
+type RunnerOption func(r *Runner)
+
+// WithBuildCommand sets the command that's run to completion on every trigger,
+// such as "go build" or "npm run build".
+// The server isn't restarted and the webpages aren't reloaded if it fails.
+func WithBuildCommand(name string, args ...string) RunnerOption {
+	return func(r *Runner) {
+		r.build = append([]string{name}, args...)
+	}
+}
+
+// WithServerCommand sets the long-running command that's restarted
+// after every successful build, such as the built webserver.
+// It's interrupted, and killed if it doesn't exit in time,
+// before being restarted and when the [Runner] stops.
+func WithServerCommand(name string, args ...string) RunnerOption {
+	return func(r *Runner) {
+		r.server = append([]string{name}, args...)
+	}
+}
+
+// WithReadyAddr makes the [Runner] wait until a TCP connection
+// to addr can be established before reloading the webpages.
+func WithReadyAddr(addr string) RunnerOption {
+	return func(r *Runner) {
+		r.readyAddr = addr
+	}
+}
+
+// WithReadyURL makes the [Runner] wait until a GET request to url
+// gets a response that's not a server error before reloading the webpages.
+// It takes precedence over [WithReadyAddr].
+func WithReadyURL(url string) RunnerOption {
+	return func(r *Runner) {
+		r.readyURL = url
+	}
+}
+
+// WithReadyTimeout sets how long to wait for the server to get ready
+// before giving up on reloading the webpages.
+//
+// Defaults to 30s.
+func WithReadyTimeout(d time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.readyTimeout = d
+	}
+}
+
+// WithStopTimeout sets how long to wait for the server
+// to exit after being interrupted before killing it.
+//
+// Defaults to 5s.
+func WithStopTimeout(d time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.stopTimeout = d
+	}
+}
+
+// WithRunnerOutput sets where the output of the commands is written to.
+//
+// Defaults to [os.Stdout] and [os.Stderr].
+func WithRunnerOutput(stdout, stderr io.Writer) RunnerOption {
+	return func(r *Runner) {
+		r.stdout = stdout
+		r.stderr = stderr
+	}
+}
@@ -0,0 +1,683 @@
+(function (config) {
+	"use strict";
+
+	var source = config.transport === "websocket"
+		? webSocketSource(config.url)
+		: new EventSource(config.url, { withCredentials: !!config.credentials });
+
+	// handlers holds the event handlers by event type,
+	// for dispatching the events caught up on after reconnecting.
+	var handlers = {};
+
+	// lastSeq is the sequence number of the last event received.
+	var lastSeq = 0;
+
+	// lastEventId is the ID of the last event received from the source.
+	// EventSource gives the events the server sends without a sequence number,
+	// such as "boot" upon reconnecting, the ID of the last event that had one,
+	// so an event with the same ID as the one before it is unnumbered.
+	var lastEventId = "";
+
+	// listeners holds the functions registered using window.livereload.on
+	// by event type.
+	var listeners = {};
+
+	// window.livereload.on calls fn with the data of the events of the given type,
+	// such as the custom ones published using Handler.Publish,
+	// and returns a function that stops calling it:
+	//
+	//	window.livereload = window.livereload || {};
+	//	window.livereload.on("theme", function (data) { ... });
+	//
+	// The webpage may set window.livereload itself before the script runs,
+	// such as for setting the accept hook, so it's extended rather than replaced.
+	// The functions it queued before the script ran, as [type, fn] pairs
+	// in window.livereload.queue, are registered,
+	// and the ones it queues afterwards are registered right away.
+	window.livereload = window.livereload || {};
+	window.livereload.on = function (type, fn) {
+		if (!handlers[type]) {
+			on(type, function () {});
+		}
+		(listeners[type] = listeners[type] || []).push(fn);
+		return function () {
+			var i = listeners[type].indexOf(fn);
+			if (i >= 0) {
+				listeners[type].splice(i, 1);
+			}
+		};
+	};
+	var queued = window.livereload.queue || [];
+	window.livereload.queue = {
+		push: function () {
+			for (var i = 0; i < arguments.length; i++) {
+				window.livereload.on(arguments[i][0], arguments[i][1]);
+			}
+		},
+	};
+	window.livereload.queue.push.apply(null, queued);
+
+	on("message", function (msg) {
+		if (msg && msg.data === "reload") {
+			reload();
+		}
+	});
+
+	on("paths", function (msg) {
+		if (matchesPath(msg.data.split("\n"), location.pathname)) {
+			reload();
+		}
+	});
+
+	// The server sends its boot ID upon connecting.
+	// A different one than the page was loaded with means the server has restarted,
+	// so the page may be stale, and the events it missed are lost.
+	on("boot", function (msg) {
+		if (msg.data !== config.boot) {
+			reload();
+		}
+	});
+
+	on("server-closing", function () {
+		console.debug("livereload: server closing, reconnecting later");
+	});
+
+	on("warning", function (msg) {
+		console.warn("livereload: " + msg.data);
+	});
+
+	on("overlay", function (msg) {
+		showOverlay(msg.data);
+	});
+
+	on("build-error", function (msg) {
+		if (msg.data) {
+			showOverlay(msg.data);
+		} else {
+			hideOverlay();
+		}
+	});
+
+	on("css", function (msg) {
+		reloadStylesheets(msg.data);
+	});
+
+	on("image", function (msg) {
+		reloadImages(msg.data);
+	});
+
+	on("asset", function (msg) {
+		reloadAssets(msg.data);
+	});
+
+	on("module", function (msg) {
+		reloadModules(msg.data);
+	});
+
+	on("wasm", function () {
+		clearWASMCaches().finally(function () {
+			reload();
+		});
+	});
+
+	// Catch up on the events missed while disconnected.
+	var disconnected = false;
+	source.addEventListener("error", function () {
+		disconnected = true;
+	});
+	source.addEventListener("open", function () {
+		if (disconnected) {
+			disconnected = false;
+			catchUp();
+		}
+	});
+
+	// on handles the events of the given type, keeping track of their sequence numbers.
+	// The listeners registered by the webpage are called before handler,
+	// so that they can save the state of the webpage before it's reloaded.
+	function on(type, handler) {
+		handlers[type] = function (msg) {
+			notify(type, msg);
+			handler(msg);
+		};
+		source.addEventListener(type, function (msg) {
+			var seq = msg.lastEventId !== lastEventId ? Number(msg.lastEventId) : 0;
+			lastEventId = msg.lastEventId;
+			// Skip the events already caught up on.
+			if (seq && seq <= lastSeq) {
+				return;
+			}
+			lastSeq = seq || lastSeq;
+			handlers[type](msg);
+		});
+	}
+
+	// notify calls the listeners of the given event type registered by the webpage.
+	function notify(type, msg) {
+		if (type === "message" && msg.data === "ping") {
+			return;
+		}
+		(listeners[type] || []).slice().forEach(function (fn) {
+			try {
+				fn(msg.data, msg);
+			} catch (err) {
+				console.error(err);
+			}
+		});
+	}
+
+	function catchUp() {
+		var url = config.url + (config.url.indexOf("?") < 0 ? "?" : "&") + "since=" + lastSeq;
+		fetch(url, {
+			credentials: config.credentials ? "include" : "same-origin",
+			cache: "no-store",
+		}).then(function (resp) {
+			return resp.json();
+		}).then(function (res) {
+			if (!res.complete || res.boot !== config.boot) {
+				// Some events may have been missed,
+				// or the server has restarted.
+				reload();
+				return;
+			}
+			res.events.forEach(function (ev) {
+				if (ev.seq <= lastSeq || !handlers[ev.type]) {
+					return;
+				}
+				lastSeq = ev.seq;
+				handlers[ev.type]({ data: ev.data, lastEventId: String(ev.seq) });
+			});
+		}).catch(function (err) {
+			console.debug("livereload: could not catch up on events: " + err);
+		});
+	}
+
+	// webSocketSource receives the events over WebSocket,
+	// dispatching them like an EventSource does,
+	// and reconnecting when the connection is lost.
+	function webSocketSource(url) {
+		var target = new EventTarget();
+		target.readyState = EventSource.CONNECTING;
+		var u = new URL(url, location.href);
+		u.protocol = u.protocol === "https:" ? "wss:" : "ws:";
+		connect();
+		return target;
+
+		function connect() {
+			var retry = 1000;
+			var ws = new WebSocket(u.href);
+			ws.onopen = function () {
+				target.readyState = EventSource.OPEN;
+				target.dispatchEvent(new Event("open"));
+			};
+			ws.onmessage = function (msg) {
+				var ev = JSON.parse(msg.data);
+				if (ev.type === "reconnect") {
+					retry = 100;
+				}
+				target.dispatchEvent(new MessageEvent(ev.type, {
+					data: ev.data,
+					lastEventId: ev.seq ? String(ev.seq) : "",
+				}));
+			};
+			ws.onclose = function () {
+				target.readyState = EventSource.CONNECTING;
+				target.dispatchEvent(new Event("error"));
+				setTimeout(connect, retry);
+			};
+		}
+	}
+
+	if (config.ghostURL) {
+		ghost();
+	}
+
+	// updateToolbar updates the toolbar, if it's shown.
+	var updateToolbar = function () {};
+
+	if (config.toolbar) {
+		toolbar();
+	}
+
+	// reload reloads the webpage,
+	// unless auto-reload is turned off in the toolbar.
+	function reload() {
+		if (config.toolbar) {
+			if (load("auto") === "off") {
+				store("pending", "1");
+				updateToolbar();
+				return;
+			}
+			store("count", Number(load("count") || 0) + 1);
+			store("last", Date.now());
+		}
+		window.location.reload();
+	}
+
+	// toolbar shows a small floating toolbar with the connection state,
+	// the time of the last reload and the number of reloads,
+	// and buttons for reloading the webpage and toggling auto-reload.
+	// The state of the toolbar is kept in sessionStorage across reloads.
+	function toolbar() {
+		store("pending", "");
+		var bar = document.createElement("div");
+		bar.id = "livereload-toolbar";
+		Object.assign(bar.style, {
+			position: "fixed",
+			right: "8px",
+			bottom: "8px",
+			zIndex: "2147483646",
+			display: "flex",
+			gap: "8px",
+			alignItems: "center",
+			padding: "4px 8px",
+			borderRadius: "6px",
+			background: "rgba(17, 17, 27, 0.85)",
+			color: "#cdd6f4",
+			font: "12px/1.5 ui-monospace, monospace",
+		});
+		var state = document.createElement("span");
+		var info = document.createElement("span");
+		var reloadNow = toolbarButton("Reload", function () {
+			window.location.reload();
+		});
+		var auto = toolbarButton("", function () {
+			store("auto", load("auto") === "off" ? "on" : "off");
+			if (load("auto") !== "off" && load("pending")) {
+				reload();
+				return;
+			}
+			updateToolbar();
+		});
+		bar.append(state, info, reloadNow, auto);
+
+		updateToolbar = function () {
+			var open = source.readyState === EventSource.OPEN;
+			state.textContent = open ? "\u25cf connected" : "\u25cb disconnected";
+			state.style.color = open ? "#a6e3a1" : "#f38ba8";
+			var last = Number(load("last"));
+			info.textContent = "reloads: " + Number(load("count") || 0) +
+				(last ? ", last: " + new Date(last).toLocaleTimeString() : "") +
+				(load("pending") ? ", changes pending" : "");
+			auto.textContent = "Auto-reload: " + (load("auto") === "off" ? "off" : "on");
+		};
+		source.addEventListener("open", updateToolbar);
+		source.addEventListener("error", updateToolbar);
+		updateToolbar();
+
+		if (document.body) {
+			document.body.appendChild(bar);
+		} else {
+			document.addEventListener("DOMContentLoaded", function () {
+				document.body.appendChild(bar);
+			});
+		}
+	}
+
+	function toolbarButton(text, onclick) {
+		var button = document.createElement("button");
+		button.textContent = text;
+		button.onclick = onclick;
+		Object.assign(button.style, {
+			border: "1px solid #585b70",
+			borderRadius: "4px",
+			background: "none",
+			color: "inherit",
+			font: "inherit",
+			cursor: "pointer",
+		});
+		return button;
+	}
+
+	// load and store access the state kept in sessionStorage,
+	// which is unavailable in some contexts, such as sandboxed iframes.
+	function load(key) {
+		try {
+			return sessionStorage.getItem("livereload-" + key);
+		} catch (e) {
+			return null;
+		}
+	}
+
+	function store(key, value) {
+		try {
+			sessionStorage.setItem("livereload-" + key, value);
+		} catch (e) {}
+	}
+
+	// ghost mirrors scrolling, clicks and form input
+	// across all webpages open at the same path.
+	// Interactions caused by mirroring aren't reported back,
+	// which is detected using isTrusted for clicks and input,
+	// and by ignoring scrolling for a moment after mirroring it.
+	function ghost() {
+		var id = Math.random().toString(36).slice(2);
+		var ignoreScrollUntil = 0;
+		var scrollTimer = null;
+
+		function send(ev) {
+			ev.id = id;
+			ev.path = location.pathname;
+			fetch(withToken(config.ghostURL), {
+				method: "POST",
+				body: JSON.stringify(ev),
+				keepalive: true,
+				credentials: config.credentials ? "include" : "same-origin",
+			}).catch(function () {});
+		}
+
+		window.addEventListener("scroll", function () {
+			if (Date.now() < ignoreScrollUntil || scrollTimer) {
+				return;
+			}
+			scrollTimer = setTimeout(function () {
+				scrollTimer = null;
+				var root = document.documentElement;
+				send({
+					type: "scroll",
+					x: ratio(window.scrollX, root.scrollWidth - root.clientWidth),
+					y: ratio(window.scrollY, root.scrollHeight - root.clientHeight),
+				});
+			}, 100);
+		}, { passive: true });
+
+		document.addEventListener("click", function (ev) {
+			if (ev.isTrusted && ev.target instanceof Element) {
+				send({ type: "click", selector: selector(ev.target) });
+			}
+		}, true);
+
+		document.addEventListener("input", function (ev) {
+			var el = ev.target;
+			if (ev.isTrusted && "value" in el && mirrored(el)) {
+				send({
+					type: "input",
+					selector: selector(el),
+					value: el.value,
+					checked: !!el.checked,
+				});
+			}
+		}, true);
+
+		source.addEventListener("ghost", function (msg) {
+			var ev = JSON.parse(msg.data);
+			if (ev.id === id || ev.path !== location.pathname) {
+				return;
+			}
+			if (ev.type === "scroll") {
+				var root = document.documentElement;
+				ignoreScrollUntil = Date.now() + 200;
+				window.scrollTo(
+					ev.x * (root.scrollWidth - root.clientWidth),
+					ev.y * (root.scrollHeight - root.clientHeight)
+				);
+				return;
+			}
+			var el = document.querySelector(ev.selector);
+			if (!el) {
+				return;
+			}
+			if (ev.type === "click") {
+				el.click();
+			} else if (ev.type === "input" && mirrored(el)) {
+				el.value = ev.value;
+				el.checked = ev.checked;
+				el.dispatchEvent(new Event("input", { bubbles: true }));
+				el.dispatchEvent(new Event("change", { bubbles: true }));
+			}
+		});
+	}
+
+	// mirrored reports whether the input of el is mirrored across webpages.
+	// The values of file inputs can't be set,
+	// and those of sensitive fields like passwords, credit card details
+	// and one-time codes aren't sent to the other devices.
+	function mirrored(el) {
+		if (el.type === "password" || el.type === "file") {
+			return false;
+		}
+		var tokens = (el.getAttribute("autocomplete") || "").toLowerCase().split(/\s+/);
+		return !tokens.some(function (token) {
+			return /^(cc-|one-time-code$|current-password$|new-password$)/.test(token);
+		});
+	}
+
+	// withToken returns url with the token required by the server added, if any.
+	// It's added as a query parameter rather than a header,
+	// to keep cross-origin requests simple and avoid CORS preflights.
+	function withToken(url) {
+		if (!config.token) {
+			return url;
+		}
+		var u = new URL(url, location.href);
+		u.searchParams.set("token", config.token);
+		return u.href;
+	}
+
+	function ratio(a, b) {
+		return b > 0 ? a / b : 0;
+	}
+
+	// selector returns a CSS selector that uniquely identifies elem.
+	function selector(elem) {
+		var parts = [];
+		for (; elem && elem !== document.documentElement; elem = elem.parentElement) {
+			if (elem.id) {
+				parts.unshift("#" + CSS.escape(elem.id));
+				break;
+			}
+			var i = 1;
+			for (var sib = elem.previousElementSibling; sib; sib = sib.previousElementSibling) {
+				i++;
+			}
+			parts.unshift(elem.tagName.toLowerCase() + ":nth-child(" + i + ")");
+		}
+		return parts.join(" > ");
+	}
+
+	// showOverlay shows message in a dismissible overlay covering the page.
+	// The styles are set through the style property,
+	// which unlike style attributes is allowed by Content-Security-Policy.
+	function showOverlay(message) {
+		hideOverlay();
+		var overlay = document.createElement("div");
+		overlay.id = "livereload-overlay";
+		Object.assign(overlay.style, {
+			position: "fixed",
+			inset: "0",
+			zIndex: "2147483647",
+			overflow: "auto",
+			padding: "2rem",
+			background: "rgba(17, 17, 27, 0.95)",
+			color: "#f38ba8",
+			font: "14px/1.5 ui-monospace, monospace",
+		});
+		var close = document.createElement("button");
+		close.textContent = "\u00d7";
+		close.title = "Dismiss (Esc)";
+		Object.assign(close.style, {
+			float: "right",
+			border: "none",
+			background: "none",
+			color: "#cdd6f4",
+			font: "2rem sans-serif",
+			cursor: "pointer",
+		});
+		close.onclick = hideOverlay;
+		var pre = document.createElement("pre");
+		pre.textContent = message;
+		pre.style.whiteSpace = "pre-wrap";
+		overlay.append(close, pre);
+		(document.body || document.documentElement).appendChild(overlay);
+	}
+
+	function hideOverlay() {
+		var overlay = document.getElementById("livereload-overlay");
+		if (overlay) {
+			overlay.remove();
+		}
+	}
+
+	document.addEventListener("keydown", function (ev) {
+		if (ev.key === "Escape") {
+			hideOverlay();
+		}
+	});
+
+	// reloadStylesheets re-fetches the stylesheets matching path,
+	// or all stylesheets if none match.
+	function reloadStylesheets(path) {
+		var links = document.querySelectorAll("link[rel~=stylesheet][href]");
+		refetchStylesheets(matching(links, "href", path));
+	}
+
+	// refetchStylesheets re-fetches the given stylesheets.
+	// The old stylesheet is kept until the new one loads, to avoid flickering.
+	function refetchStylesheets(links) {
+		each(links, function (link) {
+			var clone = link.cloneNode();
+			clone.href = bust(link.href);
+			clone.onload = clone.onerror = function () {
+				link.remove();
+			};
+			link.after(clone);
+		});
+	}
+
+	// reloadImages re-fetches the images matching path,
+	// or all images if none match.
+	function reloadImages(path) {
+		var imgs = document.querySelectorAll("img[src]");
+		refetchImages(matching(imgs, "src", path));
+	}
+
+	// refetchImages re-fetches the given images.
+	function refetchImages(imgs) {
+		each(imgs, function (img) {
+			img.src = bust(img.src);
+		});
+	}
+
+	// reloadAssets re-fetches the stylesheets and images matching path,
+	// or all stylesheets and images if none match,
+	// as the asset may be referenced by the stylesheets.
+	function reloadAssets(path) {
+		var links = document.querySelectorAll("link[rel~=stylesheet][href]");
+		var imgs = document.querySelectorAll("img[src]");
+		var matchedLinks = named(links, "href", path);
+		var matchedImgs = named(imgs, "src", path);
+		if (matchedLinks.length === 0 && matchedImgs.length === 0) {
+			matchedLinks = links;
+			matchedImgs = imgs;
+		}
+		refetchStylesheets(matchedLinks);
+		refetchImages(matchedImgs);
+	}
+
+	// clearWASMCaches deletes the WebAssembly modules from CacheStorage,
+	// where pages commonly keep them to skip downloading and compiling them.
+	function clearWASMCaches() {
+		if (!window.caches) {
+			return Promise.resolve();
+		}
+		return caches.keys().then(function (names) {
+			return Promise.all(names.map(function (name) {
+				return caches.open(name).then(function (cache) {
+					return cache.keys().then(function (reqs) {
+						return Promise.all(reqs.filter(function (req) {
+							return new URL(req.url).pathname.endsWith(".wasm");
+						}).map(function (req) {
+							return cache.delete(req);
+						}));
+					});
+				});
+			}));
+		});
+	}
+
+	// reloadModules re-imports the JavaScript modules matching path
+	// and passes them to the accept hook of the webpage,
+	// which applies them and returns true if it can,
+	// such as by re-rendering using the new exports:
+	//
+	//	window.livereload = window.livereload || {};
+	//	window.livereload.accept = function (url, module) { ... };
+	//
+	// The webpage is reloaded if it has no accept hook,
+	// no modules match path, or the hook doesn't return true.
+	function reloadModules(path) {
+		var accept = window.livereload && window.livereload.accept;
+		var name = basename(path);
+		var urls = [];
+		each(performance.getEntriesByType("resource"), function (entry) {
+			var u = new URL(entry.name);
+			u.searchParams.delete("livereload");
+			if (basename(u.pathname) === name && urls.indexOf(u.href) < 0) {
+				urls.push(u.href);
+			}
+		});
+		if (typeof accept !== "function" || urls.length === 0) {
+			reload();
+			return;
+		}
+		Promise.all(urls.map(function (url) {
+			return import(bust(url)).then(function (module) {
+				return accept(url, module) === true;
+			});
+		})).then(function (accepted) {
+			if (accepted.indexOf(false) >= 0) {
+				reload();
+			}
+		}).catch(function (err) {
+			console.debug("livereload: could not hot reload " + path + ": " + err);
+			reload();
+		});
+	}
+
+	// matching returns the elements whose attr URL has the same file name as path,
+	// or all elements if none do.
+	function matching(elems, attr, path) {
+		var matched = named(elems, attr, path);
+		return matched.length > 0 ? matched : elems;
+	}
+
+	// matchesPath reports whether path matches any of the patterns,
+	// in which "*" matches any sequence of characters other than slashes,
+	// "?" matches any single character other than a slash,
+	// and a trailing slash matches the paths under the pattern, too.
+	function matchesPath(patterns, path) {
+		return patterns.some(function (pattern) {
+			var prefix = pattern.endsWith("/");
+			var re = pattern.replace(/\/$/, "").replace(/[.+^${}()|[\]\\]/g, "\\$&")
+				.replace(/\*/g, "[^/]*").replace(/\?/g, "[^/]");
+			return new RegExp("^" + re + (prefix ? "(/.*)?$" : "$")).test(path);
+		});
+	}
+
+	// named returns the elements whose attr URL has the same file name as path.
+	function named(elems, attr, path) {
+		var name = basename(path);
+		var matched = [];
+		each(elems, function (elem) {
+			if (name && basename(new URL(elem[attr]).pathname) === name) {
+				matched.push(elem);
+			}
+		});
+		return matched;
+	}
+
+	function basename(path) {
+		return path.split(/[\\/]/).pop();
+	}
+
+	// bust returns url with a query parameter that keeps it from being cached.
+	function bust(url) {
+		var u = new URL(url);
+		u.searchParams.set("livereload", Date.now());
+		return u.href;
+	}
+
+	function each(list, fn) {
+		Array.prototype.forEach.call(list, fn);
+	}
+})({CONFIG});
@@ -0,0 +1,46 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serve
+
+import (
+	"io"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// qrQuietZone is the width of the blank margin around QR codes,
+// which scanners need to find them.
+const qrQuietZone = 2
+
+// writeQRCode writes text as a QR code drawn with unicode half blocks,
+// two rows of modules per line.
+// The colors are set explicitly, since scanners
+// can't read the inverted codes dark terminals would show otherwise.
+func writeQRCode(w io.Writer, text string) error {
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return err
+	}
+	b := new(strings.Builder)
+	for y := -qrQuietZone; y < code.Size+qrQuietZone; y += 2 {
+		b.WriteString("\x1b[30;107m") // Black on bright white.
+		for x := -qrQuietZone; x < code.Size+qrQuietZone; x++ {
+			top, bottom := code.Black(x, y), code.Black(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,12 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package serve
+
+import (
+	"syscall"
+)
+
+const soReusePort = syscall.SO_REUSEPORT
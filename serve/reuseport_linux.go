@@ -0,0 +1,17 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serve
+
+import (
+	"runtime"
+	"strings"
+)
+
+// soReusePort is SO_REUSEPORT, which the syscall package lacks on Linux.
+var soReusePort = func() int {
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return 0x200
+	}
+	return 0xf
+}()
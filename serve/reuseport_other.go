@@ -0,0 +1,16 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package serve
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePort reports that SO_REUSEPORT is unsupported on this system.
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this system")
+}
@@ -0,0 +1,22 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package serve
+
+import (
+	"syscall"
+)
+
+// reusePort sets the SO_REUSEPORT option on the socket of a listener.
+func reusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,425 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package serve provides a helper for running development servers,
+// that prints the URLs the server is reachable at on startup,
+// along with a QR code for opening it on phones and tablets.
+//
+// Serve on the loopback interface only:
+//
+//	lr := livereload.New(http.FileServer(http.Dir("frontend")))
+//	serve.ListenAndServe(ctx, ":8090", lr)
+//
+// Serve on all network interfaces, making the server reachable from other devices:
+//
+//	serve.ListenAndServe(ctx, "0.0.0.0:8090", lr)
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+type server struct {
+	out             io.Writer
+	qrCode          bool
+	hostnames       []string
+	portSearch      int
+	addrs           []string
+	reusePort       bool
+	shutdownTimeout time.Duration
+	cert            *tls.Certificate
+	devCert         bool
+	http3           bool
+
+	// scheme is the scheme of the printed URLs.
+	scheme string
+}
+
+// reconnecter is implemented by handlers
+// that can direct their clients to reconnect,
+// such as [livereload.Handler].
+type reconnecter interface {
+	Reconnect()
+}
+
+// ListenAndServe listens on the TCP network address addr,
+// and the ones added using [WithAddrs],
+// prints the URLs it's reachable at,
+// and serves handler until ctx is done,
+// at which point it shuts the server down and returns nil.
+//
+// If addr doesn't specify a host, it's listened on "127.0.0.1",
+// since the event path of [livereload.Handler]
+// would otherwise be reachable by anyone on the network.
+//
+// If addr specifies an unspecified address such as "0.0.0.0" or "::",
+// the URLs of the hostname of the machine
+// and of all the non-loopback network interfaces are printed,
+// along with a QR code of the first network interface.
+func ListenAndServe(ctx context.Context, addr string, handler http.Handler, options ...Option) error {
+
+	s := &server{
+		out:             os.Stderr,
+		qrCode:          true,
+		shutdownTimeout: time.Second,
+		scheme:          "http",
+	}
+	for _, fn := range options {
+		fn(s)
+	}
+
+	var tlsConfig *tls.Config
+	if s.cert != nil || s.devCert || s.http3 {
+		cert := s.cert
+		if cert == nil {
+			c, err := devCertificate(s.hostnames)
+			if err != nil {
+				return fmt.Errorf("could not generate development certificate: %w", err)
+			}
+			cert = &c
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{*cert}}
+		s.scheme = "https"
+	}
+
+	var listeners []net.Listener
+	closeListeners := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+	for _, addr := range append([]string{addr}, s.addrs...) {
+		l, err := s.listenAddr(addr)
+		if err != nil {
+			closeListeners()
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	var lan []string
+	fmt.Fprintf(s.out, "Serving at:\n")
+	for _, l := range listeners {
+		lan = append(lan, s.printURLs(l.Addr().(*net.TCPAddr))...)
+	}
+	if s.qrCode && len(lan) > 0 {
+		fmt.Fprintf(s.out, "\nScan to open %s:\n", lan[0])
+		writeQRCode(s.out, lan[0])
+	}
+
+	served := make(chan error, 2*len(listeners))
+	var servers []*http.Server
+	var h3Servers []*http3.Server
+	for _, l := range listeners {
+		srv := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+		servers = append(servers, srv)
+
+		if s.http3 {
+			pc, err := net.ListenPacket("udp", l.Addr().String())
+			if err != nil {
+				closeListeners()
+				for _, h3 := range h3Servers {
+					h3.Close()
+				}
+				return fmt.Errorf("could not listen for HTTP/3: %w", err)
+			}
+			h3 := &http3.Server{
+				Handler:   handler,
+				TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+				Port:      l.Addr().(*net.TCPAddr).Port,
+			}
+			h3Servers = append(h3Servers, h3)
+			// Advertise HTTP/3 to the clients connecting over TCP.
+			srv.Handler = http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				h3.SetQUICHeaders(resp.Header())
+				handler.ServeHTTP(resp, req)
+			})
+			go func() {
+				served <- h3.Serve(pc)
+			}()
+		}
+	}
+	for i, l := range listeners {
+		go func() {
+			if tlsConfig != nil {
+				served <- servers[i].ServeTLS(l, "", "")
+			} else {
+				served <- servers[i].Serve(l)
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections first,
+	// so that the clients told to reconnect
+	// reach the process taking over the addresses, if any.
+	closeListeners()
+	if rc, ok := handler.(reconnecter); ok && err == nil {
+		rc.Reconnect()
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if srv.Shutdown(shutdownCtx) != nil {
+			srv.Close()
+		}
+	}
+	for _, h3 := range h3Servers {
+		h3.Close()
+	}
+	return err
+}
+
+// listenAddr listens on addr, searching for an available port if configured.
+func (s *server) listenAddr(addr string) (net.Listener, error) {
+
+	host, port, err := net.SplitHostPort(addr)
+	if err == nil && host == "" {
+		host = "127.0.0.1"
+		addr = net.JoinHostPort(host, port)
+	}
+
+	l, err := s.listen(addr)
+	if err != nil && s.portSearch > 0 {
+		l, err = s.searchPort(host, port)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not listen: %w", err)
+	}
+	return l, nil
+}
+
+func (s *server) listen(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if s.reusePort {
+		lc.Control = reusePort
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// searchPort listens on the ports following port on host,
+// returning the first one that's available.
+func (s *server) searchPort(host, port string) (net.Listener, error) {
+	p, err := strconv.Atoi(port)
+	if err != nil || p == 0 {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	for i := 1; i <= s.portSearch && p+i <= 65535; i++ {
+		l, err := s.listen(net.JoinHostPort(host, strconv.Itoa(p+i)))
+		if err == nil {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("ports %d to %d are unavailable", p, p+s.portSearch)
+}
+
+// printURLs prints the URLs that addr is reachable at,
+// and returns the ones that are reachable from other devices.
+func (s *server) printURLs(addr *net.TCPAddr) (lan []string) {
+
+	port := strconv.Itoa(addr.Port)
+
+	if !addr.IP.IsUnspecified() {
+		host := addr.IP.String()
+		if addr.IP.IsLoopback() {
+			host = "localhost"
+		}
+		u := s.url(host, port)
+		fmt.Fprintf(s.out, "  %s\n", u)
+		s.printHostnames(port)
+		if !addr.IP.IsLoopback() {
+			lan = append(lan, u)
+		}
+		return lan
+	}
+
+	fmt.Fprintf(s.out, "  %s\n", s.url("localhost", port))
+	s.printHostnames(port)
+	if name, err := os.Hostname(); err == nil && name != "" && name != "localhost" {
+		fmt.Fprintf(s.out, "  %s\n", s.url(name, port))
+	}
+
+	// Listening on "0.0.0.0" only accepts IPv4 connections.
+	ipv4Only := addr.IP.To4() != nil
+	for _, ip := range lanIPs() {
+		if ipv4Only && ip.To4() == nil {
+			continue
+		}
+		lan = append(lan, s.url(ip.String(), port))
+	}
+	for _, u := range lan {
+		fmt.Fprintf(s.out, "  %s\n", u)
+	}
+	return lan
+}
+
+func (s *server) printHostnames(port string) {
+	for _, name := range s.hostnames {
+		fmt.Fprintf(s.out, "  %s\n", s.url(name, port))
+	}
+}
+
+func (s *server) url(host, port string) string {
+	return s.scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// lanIPs returns the addresses of the network interfaces
+// that are reachable from other devices, IPv4 addresses first.
+func lanIPs() []net.IP {
+	var ips []net.IP
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if ok && ipnet.IP.IsGlobalUnicast() {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		return ips[i].To4() != nil && ips[j].To4() == nil
+	})
+	return ips
+}
+
+// ==========
+
+type Option func(s *server)
+
+// WithOutput sets where the URLs are printed to.
+//
+// Defaults to [os.Stderr].
+func WithOutput(w io.Writer) Option {
+	return func(s *server) {
+		s.out = w
+	}
+}
+
+// WithQRCode configures whether to print a QR code
+// of the first URL that's reachable from other devices.
+//
+// Defaults to true.
+func WithQRCode(v bool) Option {
+	return func(s *server) {
+		s.qrCode = v
+	}
+}
+
+// WithHostnames adds hostnames that the server is reachable at
+// to the printed URLs, such as "myapp.localhost"
+// or the name of a tunnel to the server.
+func WithHostnames(names ...string) Option {
+	return func(s *server) {
+		s.hostnames = append(s.hostnames, names...)
+	}
+}
+
+// WithPortSearch configures how many of the ports following the port of addr
+// to try listening on, in order, if it's unavailable,
+// such as when another server is already listening on it.
+// The printed URLs contain the chosen port.
+//
+// Defaults to 0.
+func WithPortSearch(n int) Option {
+	return func(s *server) {
+		s.portSearch = n
+	}
+}
+
+// WithReusePort configures whether to listen with the SO_REUSEPORT option,
+// which lets a new process listen on the same address
+// while the current one is still running,
+// such as when restarting the development server itself,
+// so that no connections are refused in between.
+//
+// Once ctx is done, the server stops accepting connections,
+// and if handler has a Reconnect method, such as [livereload.Handler.Reconnect],
+// it's called so that the webpages reconnect to the new process.
+//
+// It's only supported on Unix-like systems,
+// where it defaults to false.
+func WithReusePort(v bool) Option {
+	return func(s *server) {
+		s.reusePort = v
+	}
+}
+
+// WithShutdownTimeout sets how long to wait for
+// the active connections to finish once ctx is done,
+// before closing them.
+//
+// Defaults to 1s.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(s *server) {
+		s.shutdownTimeout = d
+	}
+}
+
+// WithCertificate serves HTTPS using the given certificate.
+func WithCertificate(cert tls.Certificate) Option {
+	return func(s *server) {
+		s.cert = &cert
+	}
+}
+
+// WithDevCertificate serves HTTPS using a self-signed certificate
+// that's generated on startup, and is valid for localhost,
+// the addresses of the network interfaces,
+// the hostname of the machine and the hostnames set using [WithHostnames].
+// Browsers warn about the certificate, since they don't trust it.
+//
+// It's ignored if a certificate is set using [WithCertificate].
+func WithDevCertificate() Option {
+	return func(s *server) {
+		s.devCert = true
+	}
+}
+
+// WithHTTP3 configures whether to also serve HTTP/3 over QUIC,
+// on the UDP port with the same number as the TCP port.
+// The responses served over TCP advertise it using the Alt-Svc header,
+// which browsers use to switch to HTTP/3.
+//
+// HTTP/3 requires TLS, so HTTPS is served using the certificate
+// set using [WithCertificate], or the one of [WithDevCertificate] by default.
+// Browsers don't use HTTP/3 with untrusted certificates,
+// so use a trusted certificate, or configure the browser to trust it.
+//
+// Defaults to false.
+func WithHTTP3(v bool) Option {
+	return func(s *server) {
+		s.http3 = v
+	}
+}
+
+// WithAddrs adds TCP network addresses to listen on,
+// serving the same handler on all of them,
+// such as for making the server reachable from the local machine
+// and over a VPN, without exposing it to the whole network:
+//
+//	serve.ListenAndServe(ctx, "127.0.0.1:8090", lr, serve.WithAddrs("100.64.0.1:8090"))
+func WithAddrs(addrs ...string) Option {
+	return func(s *server) {
+		s.addrs = append(s.addrs, addrs...)
+	}
+}
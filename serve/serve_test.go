@@ -0,0 +1,238 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serve_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koonix/go-livereload/serve"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestListenAndServe(t *testing.T) {
+
+	out := new(bytes.Buffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	err := serve.ListenAndServe(ctx, ":0", http.NotFoundHandler(), serve.WithOutput(out))
+	if err != nil {
+		t.Fatalf("could not serve: %s", err)
+	}
+
+	if !strings.HasPrefix(out.String(), "Serving at:\n  http://localhost:") {
+		t.Errorf("incorrect output: %q", out.String())
+	}
+	if strings.Contains(out.String(), "Scan") {
+		t.Errorf("printed QR code for loopback address")
+	}
+}
+
+func TestListenAndServePortSearch(t *testing.T) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	defer l.Close()
+	addr := l.Addr().String()
+
+	out := new(bytes.Buffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	err = serve.ListenAndServe(ctx, addr, http.NotFoundHandler(),
+		serve.WithOutput(out),
+		serve.WithPortSearch(10),
+		serve.WithHostnames("myapp.localhost"),
+	)
+	if err != nil {
+		t.Fatalf("could not serve: %s", err)
+	}
+
+	_, port, _ := net.SplitHostPort(addr)
+	if strings.Contains(out.String(), ":"+port+"\n") {
+		t.Errorf("printed the unavailable port: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "\n  http://myapp.localhost:") {
+		t.Errorf("did not print the hostname: %q", out.String())
+	}
+}
+
+func TestListenAndServeReusePort(t *testing.T) {
+
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("SO_REUSEPORT is not supported")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	serveOnce := func(ctx context.Context, h http.Handler) chan error {
+		errc := make(chan error, 1)
+		go func() {
+			errc <- serve.ListenAndServe(ctx, addr, h,
+				serve.WithOutput(io.Discard),
+				serve.WithReusePort(true),
+			)
+		}()
+		return errc
+	}
+
+	old := &reconnectHandler{Handler: http.NotFoundHandler()}
+	oldCtx, cancelOld := context.WithCancel(context.Background())
+	oldErr := serveOnce(oldCtx, old)
+	time.Sleep(100 * time.Millisecond)
+
+	newCtx, cancelNew := context.WithCancel(context.Background())
+	defer cancelNew()
+	newErr := serveOnce(newCtx, http.NotFoundHandler())
+	time.Sleep(100 * time.Millisecond)
+
+	cancelOld()
+	if err := <-oldErr; err != nil {
+		t.Fatalf("could not serve: %s", err)
+	}
+	if !old.reconnected.Load() {
+		t.Errorf("handler was not told to reconnect")
+	}
+
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("new server is unreachable: %s", err)
+	}
+	resp.Body.Close()
+
+	cancelNew()
+	if err := <-newErr; err != nil {
+		t.Fatalf("could not serve: %s", err)
+	}
+}
+
+type reconnectHandler struct {
+	http.Handler
+	reconnected atomic.Bool
+}
+
+func (h *reconnectHandler) Reconnect() {
+	h.reconnected.Store(true)
+}
+
+func TestListenAndServeHTTP3(t *testing.T) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	out := new(bytes.Buffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve.ListenAndServe(ctx, addr, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			io.WriteString(resp, req.Proto)
+		}),
+			serve.WithOutput(out),
+			serve.WithHTTP3(true),
+		)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	tcp := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := tcp.Get("https://" + addr)
+	if err != nil {
+		t.Fatalf("could not make request over TCP: %s", err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(resp.Header.Get("Alt-Svc"), "h3=") {
+		t.Errorf("HTTP/3 not advertised: %q", resp.Header.Get("Alt-Svc"))
+	}
+
+	h3 := &http3.Transport{TLSClientConfig: tlsConfig}
+	defer h3.Close()
+	resp, err = (&http.Client{Transport: h3}).Get("https://" + addr)
+	if err != nil {
+		t.Fatalf("could not make request over HTTP/3: %s", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "HTTP/3.0" {
+		t.Errorf("incorrect protocol; want %q, got %q", "HTTP/3.0", body)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("could not serve: %s", err)
+	}
+	if !strings.HasPrefix(out.String(), "Serving at:\n  https://localhost:") {
+		t.Errorf("incorrect output: %q", out.String())
+	}
+}
+
+func TestListenAndServeAddrs(t *testing.T) {
+
+	var addrs []string
+	for range 2 {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("could not listen: %s", err)
+		}
+		addrs = append(addrs, l.Addr().String())
+		l.Close()
+	}
+
+	out := new(bytes.Buffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve.ListenAndServe(ctx, addrs[0], http.NotFoundHandler(),
+			serve.WithOutput(out),
+			serve.WithAddrs(addrs[1]),
+		)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, addr := range addrs {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			t.Fatalf("could not make request to %s: %s", addr, err)
+		}
+		resp.Body.Close()
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("could not serve: %s", err)
+	}
+	for _, addr := range addrs {
+		_, port, _ := net.SplitHostPort(addr)
+		if !strings.Contains(out.String(), "  http://localhost:"+port+"\n") {
+			t.Errorf("URL of %s not printed: %q", addr, out.String())
+		}
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sse provides an [http.Handler] that implements [Server-Sent Events].
+//
+// The events are numbered, and the most recent ones are kept,
+// so that clients that reconnect are sent the events they missed
+// using the "Last-Event-ID" header that browsers send when reconnecting:
+//
+//	events := sse.New(sse.WithRetry(time.Second))
+//	http.Handle("/events", events)
+//	events.Publish("build", "started")
+//
+// [Server-Sent Events]: https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events
+package sse
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koonix/go-livereload/pubsub"
+)
+
+// Handler is an [http.Handler] that implements [Server-Sent Events].
+//
+// [Server-Sent Events]: https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events
+type Handler struct {
+	pubsub *pubsub.PubSub[message]
+
+	// publishMu orders publishing the events by their sequence numbers.
+	// The events are delivered to each client in the order they're published in.
+	publishMu sync.Mutex
+
+	mu      sync.Mutex // guards seq and history
+	seq     uint64
+	history []Event
+
+	historySize int
+	retry       time.Duration
+	keepAlive   time.Duration
+}
+
+// message is a formatted event sent to the clients.
+// It's shared between the clients, and mustn't be modified.
+type message struct {
+	ev    Event
+	event []byte
+
+	// disconnect reports whether the connections
+	// are closed after sending the event.
+	disconnect bool
+}
+
+// New creates a [Handler].
+func New(options ...Option) *Handler {
+	h := &Handler{
+		pubsub:      pubsub.New[message](),
+		historySize: 64,
+		keepAlive:   10 * time.Second,
+	}
+	for _, fn := range options {
+		fn(h)
+	}
+	return h
+}
+
+// ==========
+
+type Option func(h *Handler)
+
+// WithHistorySize sets how many of the most recent events are kept
+// for sending to the clients that missed them while reconnecting,
+// and for [Handler.Since].
+//
+// Defaults to 64.
+func WithHistorySize(n int) Option {
+	return func(h *Handler) {
+		h.historySize = max(n, 0)
+	}
+}
+
+// WithRetry sets the delay the clients wait for
+// before reconnecting after their connection is lost,
+// which is sent to them when they connect.
+//
+// Defaults to zero, which leaves it to the clients; browsers use a few seconds.
+func WithRetry(d time.Duration) Option {
+	return func(h *Handler) {
+		h.retry = d
+	}
+}
+
+// WithKeepAlive sets the interval of the ping events sent to the clients,
+// which keep proxies and browsers from timing out idle connections.
+// Zero disables them.
+//
+// Defaults to 10s.
+func WithKeepAlive(d time.Duration) Option {
+	return func(h *Handler) {
+		h.keepAlive = d
+	}
+}
+
+// ==========
+
+// Publish sends an event to the clients,
+// numbering it and keeping it for [Handler.Since].
+func (h *Handler) Publish(eventType, data string) {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+	h.mu.Lock()
+	h.seq++
+	ev := Event{Seq: h.seq, Type: eventType, Data: data}
+	h.history = append(h.history, ev)
+	if len(h.history) > h.historySize {
+		h.history = slices.Clip(h.history[len(h.history)-h.historySize:])
+	}
+	h.mu.Unlock()
+	h.pubsub.Publish("", message{ev: ev, event: appendEvent(nil, ev)})
+}
+
+// PublishTransient is like Publish,
+// but the event is neither numbered nor kept,
+// for frequent events that are useless once missed.
+func (h *Handler) PublishTransient(eventType, data string) {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+	ev := Event{Type: eventType, Data: data}
+	h.pubsub.Publish("", message{ev: ev, event: appendEvent(nil, ev)})
+}
+
+// Since returns the kept events published after the one numbered seq,
+// and the number of the last published event.
+// complete reports whether no events after seq were dropped from the history,
+// which isn't the case if seq is from a previous Handler,
+// such as one of a process that has since restarted.
+func (h *Handler) Since(seq uint64) (events []Event, latest uint64, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if seq > h.seq {
+		return slices.Clone(h.history), h.seq, false
+	}
+	first := h.seq - uint64(len(h.history)) + 1
+	if seq+1 < first {
+		return slices.Clone(h.history), h.seq, false
+	}
+	return slices.Clone(h.history[seq+1-first:]), h.seq, true
+}
+
+// Disconnect sends an event with the given type to the clients
+// and closes their connections,
+// directing them to reconnect after the given delay.
+func (h *Handler) Disconnect(eventType string, retry time.Duration) {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+	ev := Event{Type: eventType}
+	h.pubsub.Publish("", message{
+		ev:         ev,
+		event:      appendEvent(appendRetry(nil, retry), ev),
+		disconnect: true,
+	})
+}
+
+// Subscribe returns a channel that receives the published events,
+// for sending them over other protocols.
+// The channel is closed after an event sent by [Handler.Disconnect],
+// or once unsubscribe is called.
+// If the events aren't received, the oldest of them are dropped
+// once hundreds are queued, like for the clients of the event stream.
+func (h *Handler) Subscribe() (events <-chan Event, unsubscribe func()) {
+	msgs, unsub := h.pubsub.Subscribe("")
+	ch := make(chan Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-done:
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				select {
+				case ch <- msg.ev:
+				case <-done:
+					return
+				}
+				if msg.disconnect {
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+			unsub()
+		})
+	}
+}
+
+func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	h.Serve(resp, req)
+}
+
+// Event is a Server-Sent Event.
+type Event struct {
+	// Seq is the sequence number of the event,
+	// sent as its ID, or 0 for an event without one.
+	Seq  uint64 `json:"seq"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// String formats the event.
+func (ev Event) String() string {
+	return string(appendEvent(nil, ev))
+}
+
+// Serve is like ServeHTTP,
+// but sends the given events to the client first.
+//
+// Clients reconnecting with the "Last-Event-ID" header
+// are sent the events they missed, if they're all still kept.
+// Otherwise, they're sent none of them, and can use [Handler.Since]
+// to find out what they missed.
+func (h *Handler) Serve(resp http.ResponseWriter, req *http.Request, initial ...Event) {
+
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		msg := "ability to flush responses unavailable"
+		http.Error(resp, msg, http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.Header().Set("X-Accel-Buffering", "no")
+	resp.WriteHeader(http.StatusOK)
+
+	evChan, unsub, initial := h.subscribe(req, initial)
+	defer unsub()
+
+	buf := bufPool.Get().(*[]byte)
+	b := (*buf)[:0]
+	if h.retry > 0 {
+		b = appendRetry(b, h.retry)
+	}
+	for _, ev := range initial {
+		b = appendEvent(b, ev)
+	}
+	_, err := resp.Write(b)
+	*buf = b
+	bufPool.Put(buf)
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	var ping <-chan time.Time
+	if h.keepAlive > 0 {
+		t := time.NewTicker(h.keepAlive)
+		defer t.Stop()
+		ping = t.C
+	}
+
+	for {
+		select {
+
+		case <-req.Context().Done():
+			return
+
+		case msg, ok := <-evChan:
+			if !ok {
+				return
+			}
+			_, err := resp.Write(msg.event)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+			if msg.disconnect {
+				return
+			}
+
+		case <-ping:
+			_, err := resp.Write(pingEvent)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+
+		}
+	}
+}
+
+// subscribe subscribes the client making req to the events,
+// and returns the events to send to it first:
+// the initial events, the events it missed if it's reconnecting,
+// and a ping event numbered as the last published event,
+// which tells the client the number of the last event it's not going to receive,
+// for catching up after reconnecting.
+func (h *Handler) subscribe(req *http.Request, initial []Event) (evChan <-chan message, unsub func(), events []Event) {
+
+	// Keep the events from being published between subscribing
+	// and looking up the missed ones, so none are skipped or sent twice.
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+
+	evChan, unsub = h.pubsub.Subscribe("")
+	events = initial
+
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		seq, err := strconv.ParseUint(id, 10, 64)
+		if err == nil {
+			missed, _, complete := h.Since(seq)
+			if complete {
+				events = append(events, missed...)
+			}
+		}
+	}
+
+	h.mu.Lock()
+	if h.seq > 0 {
+		events = append(events, Event{Seq: h.seq, Type: "message", Data: "ping"})
+	}
+	h.mu.Unlock()
+
+	return evChan, unsub, events
+}
+
+// pingEvent keeps the connections from timing out.
+var pingEvent = appendEvent(nil, Event{Type: "message", Data: "ping"})
+
+// bufPool holds the buffers the initial events are formatted into.
+var bufPool = sync.Pool{
+	New: func() any {
+		return new([]byte)
+	},
+}
+
+// appendEvent appends the formatted event to b.
+// Multi-line data is sent as multiple data fields,
+// which clients join back together with "\n",
+// splitting it at "\r\n", "\r" and "\n" alike, as clients split fields.
+// Line breaks in the type are removed, so that it can't add fields.
+func appendEvent(b []byte, ev Event) []byte {
+	if ev.Seq != 0 {
+		b = append(b, "id: "...)
+		b = strconv.AppendUint(b, ev.Seq, 10)
+		b = append(b, '\n')
+	}
+	b = append(b, "event: "...)
+	b = append(b, removeLineBreaks(ev.Type)...)
+	b = append(b, '\n')
+	data := ev.Data
+	for {
+		b = append(b, "data: "...)
+		i := strings.IndexAny(data, "\r\n")
+		if i < 0 {
+			b = append(b, data...)
+			break
+		}
+		b = append(b, data[:i]...)
+		b = append(b, '\n')
+		if strings.HasPrefix(data[i:], "\r\n") {
+			i++
+		}
+		data = data[i+1:]
+	}
+	return append(b, "\n\n"...)
+}
+
+// removeLineBreaks returns s without the "\r" and "\n" characters.
+func removeLineBreaks(s string) string {
+	if !strings.ContainsAny(s, "\r\n") {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// appendRetry appends a field that sets the reconnection delay of the client.
+func appendRetry(b []byte, retry time.Duration) []byte {
+	b = append(b, "retry: "...)
+	b = strconv.AppendInt(b, retry.Milliseconds(), 10)
+	return append(b, '\n')
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   Event
+		want string
+	}{
+		{"simple", Event{Type: "message", Data: "reload"}, "event: message\ndata: reload\n\n"},
+		{"seq", Event{Seq: 42, Type: "css", Data: "a.css"}, "id: 42\nevent: css\ndata: a.css\n\n"},
+		{"empty-data", Event{Type: "wasm"}, "event: wasm\ndata: \n\n"},
+		{"multi-line", Event{Type: "overlay", Data: "a\nb\n"}, "event: overlay\ndata: a\ndata: b\ndata: \n\n"},
+		{"carriage-return", Event{Type: "overlay", Data: "a\rb\r\nc"}, "event: overlay\ndata: a\ndata: b\ndata: c\n\n"},
+		{"type-line-break", Event{Type: "theme\r\ndata: x\nid: 9", Data: "dark"}, "event: themedata: xid: 9\ndata: dark\n\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(appendEvent(nil, test.ev))
+			if got != test.want {
+				t.Errorf("incorrect event; want %q, got %q", test.want, got)
+			}
+		})
+	}
+	got := string(appendEvent(appendRetry(nil, 1500*time.Millisecond), Event{Type: "reconnect"}))
+	if want := "retry: 1500\nevent: reconnect\ndata: \n\n"; got != want {
+		t.Errorf("incorrect retry event; want %q, got %q", want, got)
+	}
+}
+
+func BenchmarkAppendEvent(b *testing.B) {
+	ev := Event{Seq: 12345, Type: "overlay", Data: "panic serving GET /api: oops\n\ngoroutine 1 [running]:\nmain.main()"}
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for range b.N {
+		buf = appendEvent(buf[:0], ev)
+	}
+}
+
+func TestServe(t *testing.T) {
+
+	serve := func(h *Handler, lastEventID string) string {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp := httptest.NewRecorder()
+		h.Serve(resp, req)
+		return resp.Body.String()
+	}
+
+	h := New(WithRetry(2*time.Second), WithHistorySize(2))
+	h.Publish("a", "1")
+	h.Publish("b", "2")
+	h.Publish("c", "3")
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        string
+	}{
+		{"new", "", "retry: 2000\nid: 3\nevent: message\ndata: ping\n\n"},
+		{"replay", "1", "retry: 2000\nid: 2\nevent: b\ndata: 2\n\nid: 3\nevent: c\ndata: 3\n\nid: 3\nevent: message\ndata: ping\n\n"},
+		{"up-to-date", "3", "retry: 2000\nid: 3\nevent: message\ndata: ping\n\n"},
+		{"dropped", "0", "retry: 2000\nid: 3\nevent: message\ndata: ping\n\n"},
+		{"invalid", "x", "retry: 2000\nid: 3\nevent: message\ndata: ping\n\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := serve(h, test.lastEventID); got != test.want {
+				t.Errorf("incorrect events;\nwant %q\ngot  %q", test.want, got)
+			}
+		})
+	}
+
+	t.Run("keep-alive", func(t *testing.T) {
+		got := serve(New(WithKeepAlive(20*time.Millisecond)), "")
+		if !strings.HasPrefix(got, string(pingEvent)) {
+			t.Errorf("no ping event sent: %q", got)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package sse
+
+import (
+	"io"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// ServeWebSocket is like Serve, but sends the events over WebSocket,
+// as text frames containing the events as JSON,
+// for clients behind proxies that break Server-Sent Events.
+// Clients are expected to reconnect on their own.
+func (h *Handler) ServeWebSocket(ws *websocket.Conn, initial ...Event) {
+
+	// The client isn't expected to send anything;
+	// reading detects when it closes the connection.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		io.Copy(io.Discard, ws)
+	}()
+
+	evChan, unsub, initial := h.subscribe(ws.Request(), initial)
+	defer unsub()
+
+	for _, ev := range initial {
+		if websocket.JSON.Send(ws, ev) != nil {
+			return
+		}
+	}
+
+	var ping <-chan time.Time
+	if h.keepAlive > 0 {
+		t := time.NewTicker(h.keepAlive)
+		defer t.Stop()
+		ping = t.C
+	}
+
+	for {
+		select {
+
+		case <-closed:
+			return
+
+		case <-ws.Request().Context().Done():
+			return
+
+		case msg, ok := <-evChan:
+			if !ok {
+				return
+			}
+			if websocket.JSON.Send(ws, msg.ev) != nil {
+				return
+			}
+			if msg.disconnect {
+				return
+			}
+
+		case <-ping:
+			if websocket.JSON.Send(ws, Event{Type: "message", Data: "ping"}) != nil {
+				return
+			}
+
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package supervisor provides a development loop for Go webservers:
+// the program is rebuilt and restarted whenever its source files change,
+// and the webpages are reloaded once the restarted program accepts connections.
+//
+// Run a program and proxy it:
+//
+//	u, _ := url.Parse("http://localhost:8080")
+//	lr := livereload.New(livereload.ReverseProxy(u))
+//	go supervisor.New(lr, "./cmd/server", u.Host).Run(ctx)
+//	http.ListenAndServe(":8090", lr)
+//
+// Requests made while the program is restarting
+// are retried by [livereload.ReverseProxy] until the program is back up.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/koonix/go-livereload"
+	"github.com/koonix/go-livereload/internal/fswatch"
+)
+
+// Supervisor is returned by [New].
+type Supervisor struct {
+	handler      *livereload.Handler
+	pkg          string
+	addr         string
+	args         []string
+	dirs         []string
+	pollInterval time.Duration
+	stopTimeout  time.Duration
+	stdout       io.Writer
+	stderr       io.Writer
+}
+
+// New creates a [Supervisor] that updates the webpages of lr.
+//
+// Supervisor builds the Go package pkg using "go build", runs it,
+// and rebuilds and restarts it whenever a ".go" file changes,
+// using a [livereload.Runner].
+// Once the program accepts TCP connections at addr,
+// the webpages are reloaded.
+// If the build fails, the program keeps running,
+// and the output of the build is shown on the webpages
+// using [livereload.Handler.ReloadError].
+// Failures are logged using the logger of lr,
+// which is set using [livereload.WithLogger].
+//
+// The current directory is watched for changes by default.
+// Use the [WithWatchDirs] option to change this.
+func New(lr *livereload.Handler, pkg, addr string, options ...Option) *Supervisor {
+	s := &Supervisor{
+		handler:      lr,
+		pkg:          pkg,
+		addr:         addr,
+		dirs:         []string{"."},
+		pollInterval: 500 * time.Millisecond,
+		stopTimeout:  5 * time.Second,
+		stdout:       os.Stdout,
+		stderr:       os.Stderr,
+	}
+	for _, fn := range options {
+		fn(s)
+	}
+	return s
+}
+
+// Run runs the supervision loop until ctx is done,
+// at which point the program is stopped and Run returns nil.
+func (s *Supervisor) Run(ctx context.Context) error {
+
+	tmp, err := os.MkdirTemp("", "livereload-")
+	if err != nil {
+		return fmt.Errorf("could not create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	bin := filepath.Join(tmp, "upstream")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+
+	r := livereload.NewRunner(s.handler,
+		livereload.WithBuildCommand("go", "build", "-o", bin, s.pkg),
+		livereload.WithServerCommand(bin, s.args...),
+		livereload.WithReadyAddr(s.addr),
+		livereload.WithStopTimeout(s.stopTimeout),
+		livereload.WithRunnerOutput(s.stdout, s.stderr),
+	)
+	go fswatch.Watch(ctx, s.pollInterval, s.dirs, isGoSource, func([]string) {
+		r.Trigger()
+	})
+	r.Run(ctx)
+	return nil
+}
+
+func isGoSource(path string, dir bool) bool {
+	return dir || strings.HasSuffix(path, ".go")
+}
+
+// ==========
+
+type Option func(s *Supervisor)
+
+// WithArgs sets the command-line arguments passed to the program.
+func WithArgs(args ...string) Option {
+	return func(s *Supervisor) {
+		s.args = args
+	}
+}
+
+// WithWatchDirs sets the directories
+// that are recursively watched for changes to ".go" files.
+//
+// Defaults to the current directory.
+func WithWatchDirs(dirs ...string) Option {
+	return func(s *Supervisor) {
+		s.dirs = dirs
+	}
+}
+
+// WithPollInterval sets how often the watched directories are checked for changes.
+//
+// Defaults to 500ms.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Supervisor) {
+		s.pollInterval = d
+	}
+}
+
+// WithStopTimeout sets how long to wait for the program
+// to exit after being interrupted before killing it.
+//
+// Defaults to 5s.
+func WithStopTimeout(d time.Duration) Option {
+	return func(s *Supervisor) {
+		s.stopTimeout = d
+	}
+}
+
+// WithOutput sets where the output of the build and the program is written to.
+//
+// Defaults to [os.Stdout] and [os.Stderr].
+func WithOutput(stdout, stderr io.Writer) Option {
+	return func(s *Supervisor) {
+		s.stdout = stdout
+		s.stderr = stderr
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package supervisor_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koonix/go-livereload"
+	"github.com/koonix/go-livereload/sse"
+	"github.com/koonix/go-livereload/supervisor"
+)
+
+const program = `package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+func main() {
+	http.ListenAndServe(os.Args[1], http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(resp, "VERSION")
+	}))
+}
+`
+
+// syncBuffer is a [bytes.Buffer] that's safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSupervisor(t *testing.T) {
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command is not available")
+	}
+
+	// The builds may take a while with a cold build cache.
+	const timeout = time.Minute
+
+	// start writes the program with the given version into a new directory,
+	// and supervises it until the test ends or stop is called,
+	// which waits for Run to return.
+	start := func(t *testing.T, version string) (lr *livereload.Handler, src, addr string, reloads <-chan struct{}, logs *syncBuffer, stop func()) {
+		t.Helper()
+		dir := t.TempDir()
+		src = filepath.Join(dir, "main.go")
+		writeProgram(t, src, version)
+		addr = freeAddr(t)
+		r := make(chan struct{}, 10)
+		logs = new(syncBuffer)
+		lr = livereload.New(http.NotFoundHandler(),
+			livereload.WithLogger(slog.New(slog.NewTextHandler(logs, nil))),
+			livereload.WithOnReload(func(sse.Event) { r <- struct{}{} }),
+		)
+		s := supervisor.New(lr, src, addr,
+			supervisor.WithArgs(addr),
+			supervisor.WithWatchDirs(dir),
+			supervisor.WithPollInterval(20*time.Millisecond),
+			supervisor.WithOutput(io.Discard, io.Discard),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Run(ctx)
+		}()
+		stop = func() {
+			cancel()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("Run returned an error: %s", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("Run did not return after ctx was done")
+			}
+		}
+		t.Cleanup(cancel)
+		return lr, src, addr, r, logs, stop
+	}
+
+	expectReload := func(t *testing.T, reloads <-chan struct{}) {
+		t.Helper()
+		select {
+		case <-reloads:
+		case <-time.After(timeout):
+			t.Fatal("expected a reload")
+		}
+	}
+
+	t.Run("restart", func(t *testing.T) {
+		_, src, addr, reloads, _, _ := start(t, "v1")
+		expectReload(t, reloads)
+		if got := get(t, addr); got != "v1" {
+			t.Fatalf("incorrect response; want %q, got %q", "v1", got)
+		}
+		writeProgram(t, src, "v2")
+		expectReload(t, reloads)
+		if got := get(t, addr); got != "v2" {
+			t.Errorf("program not restarted; want %q, got %q", "v2", got)
+		}
+	})
+
+	t.Run("build-failure", func(t *testing.T) {
+		lr, src, addr, reloads, logs, _ := start(t, "v1")
+		expectReload(t, reloads)
+		err := os.WriteFile(src, []byte("package main\n\nfunc main() {"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(timeout)
+		for !strings.Contains(logs.String(), "build failed") {
+			if time.Now().After(deadline) {
+				t.Fatalf("build failure not logged: %s", logs.String())
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		select {
+		case <-reloads:
+			t.Errorf("unexpected reload after a failed build")
+		default:
+		}
+		resp := httptest.NewRecorder()
+		lr.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livereloadevents?since=0", nil))
+		if !strings.Contains(resp.Body.String(), `"type":"build-error"`) {
+			t.Errorf("build failure not shown on the webpages: %s", resp.Body.String())
+		}
+		if got := get(t, addr); got != "v1" {
+			t.Errorf("program not kept running after a failed build; want %q, got %q", "v1", got)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		_, _, addr, reloads, _, stop := start(t, "v1")
+		expectReload(t, reloads)
+		stop()
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			t.Errorf("program still running after Run returned")
+		}
+	})
+}
+
+func writeProgram(t *testing.T, path, version string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(strings.Replace(program, "VERSION", version, 1)), 0o644)
+	if err != nil {
+		t.Fatalf("could not write the program: %s", err)
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not find a free port: %s", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func get(t *testing.T, addr string) string {
+	t.Helper()
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("could not reach the program: %s", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return string(b)
+}
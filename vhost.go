@@ -0,0 +1,108 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// VirtualHosts returns an [http.Handler] that routes the requests
+// to the upstream of the host pattern that matches their Host header,
+// for developing sites spanning multiple domains through one [Handler].
+// Requests that no pattern matches are responded to with 404 Not Found.
+//
+// A pattern is either a hostname such as "api.localhost",
+// a wildcard such as "*.app.localhost" that matches its subdomains,
+// or "*" that matches every host.
+// Hostnames take precedence over wildcards,
+// and longer wildcards take precedence over shorter ones.
+// Ports are ignored.
+//
+//	lr := livereload.New(livereload.VirtualHosts(map[string]http.Handler{
+//		"*.app.localhost": livereload.ReverseProxy(appURL),
+//		"api.localhost":   livereload.ReverseProxy(apiURL),
+//	}))
+//
+// The upstreams created by [ReverseProxy] are watched for restarts.
+// See [WithRestartDetection] for details.
+func VirtualHosts(hosts map[string]http.Handler) http.Handler {
+	v := &virtualHosts{
+		exact: make(map[string]http.Handler),
+	}
+	for pattern, upstream := range hosts {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || strings.HasPrefix(pattern, "*.") {
+			v.wildcards = append(v.wildcards, wildcardHost{
+				suffix:   strings.TrimPrefix(pattern, "*"),
+				upstream: upstream,
+			})
+		} else {
+			v.exact[pattern] = upstream
+		}
+	}
+	sort.Slice(v.wildcards, func(i, j int) bool {
+		return len(v.wildcards[i].suffix) > len(v.wildcards[j].suffix)
+	})
+	return v
+}
+
+type virtualHosts struct {
+	exact     map[string]http.Handler
+	wildcards []wildcardHost
+}
+
+type wildcardHost struct {
+	// suffix is the pattern without the leading "*",
+	// or empty for the "*" pattern.
+	suffix   string
+	upstream http.Handler
+}
+
+func (v *virtualHosts) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	upstream := v.match(req.Host)
+	if upstream == nil {
+		http.Error(resp, "no upstream for host "+req.Host, http.StatusNotFound)
+		return
+	}
+	upstream.ServeHTTP(resp, req)
+}
+
+func (v *virtualHosts) match(host string) http.Handler {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if upstream, ok := v.exact[host]; ok {
+		return upstream
+	}
+	for _, w := range v.wildcards {
+		if w.suffix == "" || strings.HasSuffix(host, w.suffix) {
+			return w.upstream
+		}
+	}
+	return nil
+}
+
+// watchRestarts watches the upstreams that can detect their own restarts.
+func (v *virtualHosts) watchRestarts(ctx context.Context, fn func()) {
+	var watchers []restartWatcher
+	for _, upstream := range v.exact {
+		if rw, ok := upstream.(restartWatcher); ok {
+			watchers = append(watchers, rw)
+		}
+	}
+	for _, w := range v.wildcards {
+		if rw, ok := w.upstream.(restartWatcher); ok {
+			watchers = append(watchers, rw)
+		}
+	}
+	for _, rw := range watchers {
+		go rw.watchRestarts(ctx, fn)
+	}
+	<-ctx.Done()
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 the go-livereload authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package livereload
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/koonix/go-livereload/internal/fswatch"
+)
+
+// Watcher watches directories for file changes,
+// and updates the webpages using [Handler.ReloadFiles].
+//
+// The directories are polled, which works on every platform and filesystem,
+// but walks them and stats their files on every poll.
+// For large trees, exclude the directories that don't need watching,
+// such as "node_modules", which are then skipped without being walked,
+// and increase the interval using [WithPollInterval].
+//
+// Watch a directory that's also served:
+//
+//	lr := livereload.New(http.FileServer(http.Dir("frontend")))
+//	go livereload.Watch(ctx, lr, "frontend")
+type Watcher struct {
+	handler      *Handler
+	pollInterval time.Duration
+	debounce     time.Duration
+	include      []string
+	exclude      []string
+	onChange     func(changed ...string)
+}
+
+// defaultExclude matches the temporary and backup files of common editors.
+var defaultExclude = []string{
+	"*~", "*.swp", "*.swx", "*.tmp", ".#*", "#*#", "4913",
+}
+
+// NewWatcher creates a [Watcher] that updates the webpages of h.
+func NewWatcher(h *Handler, options ...WatchOption) *Watcher {
+	w := &Watcher{
+		handler:      h,
+		pollInterval: 300 * time.Millisecond,
+		debounce:     100 * time.Millisecond,
+		exclude:      append([]string{}, defaultExclude...),
+	}
+	for _, fn := range options {
+		fn(w)
+	}
+	return w
+}
+
+// Watch is a shorthand for creating a [Watcher] with the default options
+// and watching the given directories.
+func Watch(ctx context.Context, h *Handler, dirs ...string) {
+	NewWatcher(h).Watch(ctx, dirs...)
+}
+
+// Watch recursively watches dirs for file changes until ctx is done.
+// The files changed together are reloaded together,
+// once no more files change for the debounce duration.
+// The paths passed to [Handler.ReloadFiles] are relative to the watched directory,
+// and use forward slashes.
+// Directories whose names start with a dot (such as ".git") are skipped.
+func (w *Watcher) Watch(ctx context.Context, dirs ...string) {
+
+	changes := make(chan []string)
+	go fswatch.Watch(ctx, w.pollInterval, dirs,
+		func(p string, dir bool) bool {
+			if dir {
+				// Skip the excluded directories without walking them.
+				return !matchAny(w.exclude, relPath(dirs, p))
+			}
+			return w.match(relPath(dirs, p))
+		},
+		func(changed []string) {
+			select {
+			case changes <- changed:
+			case <-ctx.Done():
+			}
+		},
+	)
+
+	pending := make(map[string]struct{})
+	var timer *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case changed := <-changes:
+			for _, p := range changed {
+				pending[relPath(dirs, p)] = struct{}{}
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(w.debounce)
+			fire = timer.C
+		case <-fire:
+			paths := make([]string, 0, len(pending))
+			for p := range pending {
+				paths = append(paths, p)
+			}
+			clear(pending)
+			timer, fire = nil, nil
+			if w.onChange != nil {
+				w.onChange(paths...)
+			} else {
+				w.handler.ReloadFiles(paths...)
+			}
+		}
+	}
+}
+
+// match reports whether the file at the slash-separated path rel should be watched.
+func (w *Watcher) match(rel string) bool {
+	if len(w.include) > 0 && !matchAny(w.include, rel) {
+		return false
+	}
+	return !matchAny(w.exclude, rel)
+}
+
+// matchAny reports whether any of the patterns match rel.
+// Patterns containing a slash are matched against rel,
+// and the others against the names of the file and its parent directories.
+func matchAny(patterns []string, rel string) bool {
+	names := strings.Split(rel, "/")
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, rel); ok {
+				return true
+			}
+			continue
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// relPath returns p relative to the first of dirs that contains it,
+// using forward slashes.
+func relPath(dirs []string, p string) string {
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, p)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(p)
+}
+
+// ==========
+
+type WatchOption func(w *Watcher)
+
+// WithPollInterval sets how often the watched directories are checked for changes.
+// Every check walks the watched directories, so longer intervals
+// lower the CPU and disk usage for large trees, at the cost of latency.
+//
+// Defaults to 300ms.
+func WithPollInterval(d time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.pollInterval = d
+	}
+}
+
+// WithDebounce sets how long to wait for more files to change
+// before updating the webpages, so that the files written together,
+// such as by a build tool, are reloaded together.
+//
+// Defaults to 100ms.
+func WithDebounce(d time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.debounce = d
+	}
+}
+
+// WithInclude restricts watching to the files matching any of the [path.Match] patterns.
+// Patterns containing a slash are matched against the path of the file
+// relative to the watched directory, such as "static/*.css",
+// and the others against the names of the file and its parent directories,
+// such as "*.html" or "src".
+func WithInclude(patterns ...string) WatchOption {
+	return func(w *Watcher) {
+		w.include = append(w.include, patterns...)
+	}
+}
+
+// WithExclude ignores the files matching any of the [path.Match] patterns,
+// which are matched like the ones of [WithInclude],
+// such as "node_modules" or "*.log".
+// Directories matching them are skipped without being walked.
+//
+// The temporary and backup files of common editors,
+// such as "*.swp" and "*~", are excluded by default.
+func WithExclude(patterns ...string) WatchOption {
+	return func(w *Watcher) {
+		w.exclude = append(w.exclude, patterns...)
+	}
+}
+
+// WithOnChange makes the [Watcher] call fn with the changed paths
+// instead of updating the webpages, such as for triggering a [Runner]
+// that reloads the webpages once the changes are built.
+func WithOnChange(fn func(changed ...string)) WatchOption {
+	return func(w *Watcher) {
+		w.onChange = fn
+	}
+}